@@ -2,26 +2,98 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/grpcserver"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/handlers"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
 
 	"github.com/gin-gonic/gin"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"google.golang.org/grpc"
 )
 
+// shutdownTimeout ограничивает ожидание запросов, принятых до сигнала остановки
+const shutdownTimeout = 10 * time.Second
+
 func main() {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	cfg, err := config.LoadConfig(ctx)
+	cfg, err := config.New()
 	if err != nil {
 		panic(err)
 	}
-	server := gin.Default()
 
-	handlers.SetupRoutes(server, cfg)
+	if flag.Arg(0) == "migrate" {
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		err := runMigrate(ctx, cfg, flag.Args()[1:], os.Stdout)
+		stop()
+		if err != nil {
+			cfg.Sugar.Error("Ошибка миграции:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	setupCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := config.Setup(setupCtx, cfg); err != nil {
+		panic(err)
+	}
+	router := gin.Default()
+
+	handlers.SetupRoutes(router, cfg)
 
-	server.Run(cfg.FlagRunAddr)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var grpcServer *grpc.Server
+	if cfg.FlagGRPCAddr != "" {
+		listener, err := net.Listen("tcp", cfg.FlagGRPCAddr)
+		if err != nil {
+			panic(err)
+		}
+		grpcServer = grpcserver.New(cfg)
+		go func() {
+			if err := grpcServer.Serve(listener); err != nil {
+				cfg.Sugar.Error("Ошибка gRPC-сервера:", err)
+				stop()
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: cfg.FlagRunAddr, Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			cfg.Sugar.Error("Ошибка HTTP-сервера:", err)
+			stop()
+		}
+	}()
+	<-ctx.Done()
+
+	// Сначала дожидаемся обработки принятых запросов: они ещё ставят удаления и переходы в очереди
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		cfg.Sugar.Error("Ошибка остановки HTTP-сервера:", err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+	// Перепроверка списков блокировки ставит удаления в очередь, поэтому останавливается раньше Deleter
+	if cfg.Watcher != nil {
+		cfg.Watcher.Close()
+	}
+	cfg.Deleter.Close()
+	cfg.Recorder.Close()
+	cfg.Reaper.Close()
 	cfg.File.Close()
+	if pgStorage, ok := cfg.Store.(*storage.PostgresStorage); ok {
+		pgStorage.Close()
+	}
 }
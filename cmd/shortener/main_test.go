@@ -1,22 +1,41 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/skakunma/go-musthave-shortener-tpl/api/pb"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/grpcserver"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/handlers"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 
 	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
 )
 
 var testRouter *gin.Engine
@@ -118,7 +137,9 @@ func TestBatch(t *testing.T) {
 		want        int
 		wantPattern string
 	}{
-		{"Good request", "application/json", `[{"correlation_id":"abc123","original_url":"https://example.com/long-url-1"}]`, http.StatusCreated, `^\[{"correlation_id":"[a-zA-Z0-9]+","short_url":"http://localhost:8080/[a-zA-Z0-9]{7}"}\]$`},
+		{"Good request", "application/json", `[{"correlation_id":"abc123","original_url":"https://example.com/long-url-1"}]`, http.StatusCreated, `^\[{"correlation_id":"[a-zA-Z0-9]+","short_url":"http://localhost:8080/[a-zA-Z0-9]{7}","status":"created"}\]$`},
+		{"Empty batch", "application/json", `[]`, http.StatusBadRequest, ""},
+		{"All invalid", "application/json", `[{"correlation_id":"a","original_url":""},{"correlation_id":"b","original_url":"not a url"}]`, http.StatusBadRequest, ""},
 	}
 
 	for _, tt := range tests {
@@ -137,3 +158,976 @@ func TestBatch(t *testing.T) {
 		})
 	}
 }
+
+func TestBatchPartialSuccess(t *testing.T) {
+	alias := "batch-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	request := `[
+		{"correlation_id":"ok","original_url":"https://example.com/batch-partial"},
+		{"correlation_id":"missing","original_url":""},
+		{"correlation_id":"bad-url","original_url":"not a url"},
+		{"correlation_id":"bad-ttl","original_url":"https://example.com/batch-ttl","ttl_seconds":-1},
+		{"correlation_id":"alias","original_url":"https://example.com/batch-alias-1","alias":"` + alias + `"},
+		{"correlation_id":"alias-taken","original_url":"https://example.com/batch-alias-2","alias":"` + alias + `"}
+	]`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(request))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	require.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var items []struct {
+		CorrelationID string `json:"correlation_id"`
+		ShortURL      string `json:"short_url"`
+		Status        string `json:"status"`
+		Error         string `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+	require.Len(t, items, 6)
+
+	want := map[string][2]string{
+		"ok":          {"created", ""},
+		"missing":     {"invalid", "missing_field"},
+		"bad-url":     {"invalid", "invalid_url"},
+		"bad-ttl":     {"invalid", "invalid_expiry"},
+		"alias":       {"created", ""},
+		"alias-taken": {"error", "alias_taken"},
+	}
+	for _, item := range items {
+		assert.Equal(t, want[item.CorrelationID][0], item.Status, item.CorrelationID)
+		assert.Equal(t, want[item.CorrelationID][1], item.Error, item.CorrelationID)
+		assert.Equal(t, item.Status == "created", item.ShortURL != "", item.CorrelationID)
+	}
+	assert.Equal(t, testConfig.FlagBaseURL+alias, items[4].ShortURL)
+}
+
+type streamResult struct {
+	Line          int    `json:"line"`
+	CorrelationID string `json:"correlation_id"`
+	ShortURL      string `json:"short_url"`
+	Status        string `json:"status"`
+	Error         string `json:"error"`
+}
+
+func TestStream(t *testing.T) {
+	post := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/stream", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	decode := func(t *testing.T, body string) []streamResult {
+		var results []streamResult
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			var result streamResult
+			require.NoError(t, json.Unmarshal([]byte(line), &result), line)
+			results = append(results, result)
+		}
+		return results
+	}
+
+	t.Run("Mixed items", func(t *testing.T) {
+		w := post(`{"correlation_id":"s1","original_url":"https://example.com/stream-1"}
+
+{broken
+{"correlation_id":"s2","original_url":"not a url"}
+{"correlation_id":"s3","original_url":"https://example.com/stream-3"}
+`)
+		require.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+
+		results := decode(t, w.Body.String())
+		require.Len(t, results, 4)
+		assert.Equal(t, streamResult{Line: 3, Status: "invalid", Error: "invalid_json"}, results[1])
+		assert.Equal(t, streamResult{Line: 4, CorrelationID: "s2", Status: "invalid", Error: "invalid_url"}, results[2])
+		for _, result := range []streamResult{results[0], results[3]} {
+			assert.Equal(t, "created", result.Status)
+			assert.Regexp(t, `^http://localhost:8080/[a-zA-Z]{7}$`, result.ShortURL)
+		}
+		assert.Equal(t, []int{1, 5}, []int{results[0].Line, results[3].Line})
+	})
+
+	t.Run("Too many items", func(t *testing.T) {
+		limit := testConfig.FlagStreamLimit
+		testConfig.FlagStreamLimit = 2
+		defer func() { testConfig.FlagStreamLimit = limit }()
+
+		var body strings.Builder
+		for i := 0; i < 3; i++ {
+			body.WriteString(`{"correlation_id":"l` + strconv.Itoa(i) + `","original_url":"https://example.com/limit/` + strconv.Itoa(i) + `"}` + "\n")
+		}
+		results := decode(t, post(body.String()).Body.String())
+		require.Len(t, results, 3)
+		assert.Equal(t, "created", results[1].Status)
+		assert.Equal(t, "too_many_items", results[2].Error)
+	})
+
+	t.Run("Line too long", func(t *testing.T) {
+		body := `{"correlation_id":"long","original_url":"https://example.com/` + strings.Repeat("a", 70*1024) + `"}`
+		results := decode(t, post(body).Body.String())
+		require.Len(t, results, 1)
+		assert.Equal(t, "line_too_long", results[0].Error)
+	})
+
+	t.Run("Wrong content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten/stream", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+// TestStreamFullDuplex проверяет, что результаты первой порции приходят до конца загрузки
+func TestStreamFullDuplex(t *testing.T) {
+	server := httptest.NewServer(testRouter)
+	defer server.Close()
+
+	body, upload := io.Pipe()
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/api/shorten/stream", body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+
+	const chunk = 500
+	go func() {
+		for i := 0; i < chunk; i++ {
+			fmt.Fprintf(upload, `{"correlation_id":"d%d","original_url":"https://example.com/duplex/%d"}`+"\n", i, i)
+		}
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Загрузка ещё не закончена, но первая порция уже сохранена и отправлена
+	scanner := bufio.NewScanner(resp.Body)
+	for i := 0; i < chunk; i++ {
+		require.True(t, scanner.Scan())
+	}
+	var last streamResult
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &last))
+	assert.Equal(t, "created", last.Status)
+
+	fmt.Fprintln(upload, `{"correlation_id":"tail","original_url":"https://example.com/duplex/tail"}`)
+	require.NoError(t, upload.Close())
+	require.True(t, scanner.Scan())
+	require.NoError(t, json.Unmarshal(scanner.Bytes(), &last))
+	assert.Equal(t, "tail", last.CorrelationID)
+	assert.False(t, scanner.Scan())
+}
+
+func TestDeleteUserURLs(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/to-delete"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	key := strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+	owner := w.Result().Cookies()
+
+	tests := []struct {
+		name    string
+		cookies []*http.Cookie
+		want    int
+	}{
+		{"Foreign user", nil, http.StatusTemporaryRedirect},
+		{"Owner", owner, http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/urls", bytes.NewBufferString(`["`+key+`"]`))
+			req.Header.Set("Content-Type", "application/json")
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusAccepted, w.Code)
+
+			assert.Eventually(t, func() bool {
+				w := httptest.NewRecorder()
+				testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+				return w.Code == tt.want
+			}, 3*time.Second, 50*time.Millisecond)
+		})
+	}
+}
+
+func TestGetLinkStats(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/with-stats"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	key := strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+	owner := w.Result().Cookies()
+
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	t.Run("Foreign user", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/urls/"+key+"/stats", nil))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Owner", func(t *testing.T) {
+		assert.Eventually(t, func() bool {
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+key+"/stats", nil)
+			for _, cookie := range owner {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			var stats struct {
+				TotalClicks    int `json:"total_clicks"`
+				UniqueVisitors int `json:"unique_visitors"`
+			}
+			if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &stats) != nil {
+				return false
+			}
+			return stats.TotalClicks == 3 && stats.UniqueVisitors == 1
+		}, 3*time.Second, 50*time.Millisecond)
+	})
+}
+
+func TestLinkExpiration(t *testing.T) {
+	tests := []struct {
+		name    string
+		request string
+		want    int
+	}{
+		{"Both expires_at and ttl_seconds", `{"url": "https://example.com/both", "ttl_seconds": 10, "expires_at": "2100-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"Negative ttl_seconds", `{"url": "https://example.com/negative", "ttl_seconds": -1}`, http.StatusBadRequest},
+		{"expires_at in the past", `{"url": "https://example.com/past", "expires_at": "2000-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{"Future expires_at", `{"url": "https://example.com/future", "expires_at": "2100-01-01T00:00:00Z"}`, http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(tt.request))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			assert.Equal(t, tt.want, w.Code)
+		})
+	}
+
+	t.Run("Expired link", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/short-lived", "ttl_seconds": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusCreated, w.Code)
+
+		var created Response
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		key := strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+		owner := w.Result().Cookies()
+
+		assert.Eventually(t, func() bool {
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+			return w.Code == http.StatusGone
+		}, 3*time.Second, 100*time.Millisecond)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+		for _, cookie := range owner {
+			req.AddCookie(cookie)
+		}
+		w = httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusNoContent, w.Code)
+
+		purged, err := testConfig.Store.PurgeExpired(context.Background(), time.Now())
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, purged, 1)
+
+		w = httptest.NewRecorder()
+		testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	// Очистка уменьшает число ссылок, но идентификаторы новых ссылок не должны повторять существующие
+	t.Run("Shorten after purge", func(t *testing.T) {
+		shorten := func(body string) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			require.Equal(t, http.StatusCreated, w.Code)
+		}
+		shorten(`{"url": "https://example.com/purged-soon", "ttl_seconds": 1}`)
+		shorten(`{"url": "https://example.com/kept-after-purge"}`)
+		time.Sleep(1100 * time.Millisecond)
+		purged, err := testConfig.Store.PurgeExpired(context.Background(), time.Now())
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, purged, 1)
+		shorten(`{"url": "https://example.com/after-purge"}`)
+
+		owners := map[string]string{}
+		require.NoError(t, testConfig.Store.ForEachLink(context.Background(), func(link storage.LinkInfo) error {
+			assert.NotContains(t, owners, link.UUID, "%s и %s", owners[link.UUID], link.ShortURL)
+			owners[link.UUID] = link.ShortURL
+			return nil
+		}))
+	})
+}
+
+// fixedGenerator всегда выдаёт один и тот же код, как исчерпанное пространство кодов
+type fixedGenerator string
+
+func (g fixedGenerator) Generate(context.Context, string, int) (string, error) {
+	return string(g), nil
+}
+
+func TestShortenCodeCollisions(t *testing.T) {
+	generator := testConfig.Generator
+	testConfig.Generator = fixedGenerator("always-same")
+	defer func() { testConfig.Generator = generator }()
+
+	shorten := func(original string) int {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "`+original+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w.Code
+	}
+	require.Equal(t, http.StatusCreated, shorten("https://example.com/collision-first"))
+
+	done := make(chan int)
+	go func() { done <- shorten("https://example.com/collision-second") }()
+	select {
+	case code := <-done:
+		assert.Equal(t, http.StatusBadRequest, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("подбор кода не остановился")
+	}
+}
+
+func TestAlias(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		request     string
+		want        int
+		wantPattern string
+	}{
+		{"Valid alias", "/api/shorten", `{"url": "https://example.com/spring", "alias": "spring-sale"}`, http.StatusCreated, `^\{"result":"http://localhost:8080/spring-sale"\}$`},
+		{"Taken alias", "/api/shorten", `{"url": "https://example.com/autumn", "alias": "spring-sale"}`, http.StatusConflict, `"error":"alias_taken"`},
+		{"Reserved alias", "/api/shorten", `{"url": "https://example.com/reserved", "alias": "API"}`, http.StatusBadRequest, `"error":"reserved_alias"`},
+		{"Invalid alias", "/api/shorten", `{"url": "https://example.com/invalid", "alias": "a b/c"}`, http.StatusBadRequest, `"error":"invalid_alias"`},
+		{"Batch alias", "/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://example.com/winter","alias":"winter-sale"}]`, http.StatusCreated, `"short_url":"http://localhost:8080/winter-sale"`},
+		{"Batch taken alias", "/api/shorten/batch", `[{"correlation_id":"1","original_url":"https://example.com/summer","alias":"winter-sale"}]`, http.StatusConflict, `"error":"alias_taken"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.request))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Regexp(t, tt.wantPattern, w.Body.String())
+		})
+	}
+
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/spring-sale", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/spring", w.Header().Get("Location"))
+}
+
+func TestExpandBatch(t *testing.T) {
+	shorten := func(body string, cookies []*http.Cookie) (string, []*http.Cookie) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return strings.TrimPrefix(created.Result, testConfig.FlagBaseURL), w.Result().Cookies()
+	}
+	active, owner := shorten(`{"url": "https://example.com/expand-active"}`, nil)
+	deleted, _ := shorten(`{"url": "https://example.com/expand-deleted"}`, owner)
+	expired, _ := shorten(`{"url": "https://example.com/expand-expired", "expires_at": "`+time.Now().Add(time.Second).Format(time.RFC3339Nano)+`"}`, owner)
+	ownerID, err := testConfig.Store.GetLinkOwner(context.Background(), deleted)
+	require.NoError(t, err)
+	require.NoError(t, testConfig.Store.DeleteUserLinks(context.Background(), []storage.DeleteRequest{{UserID: ownerID, ShortURLs: []string{deleted}}}))
+	time.Sleep(1100 * time.Millisecond)
+
+	keys := []string{testConfig.FlagBaseURL + active, deleted, expired, "missing-code", "a/b"}
+	expand := func(cookies []*http.Cookie) []map[string]interface{} {
+		body, err := json.Marshal(keys)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/api/expand/batch", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		var items []map[string]interface{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &items))
+		require.Len(t, items, len(keys))
+		return items
+	}
+
+	stranger := expand(nil)
+	assert.Equal(t, map[string]interface{}{"short_url": testConfig.FlagBaseURL + active, "original_url": "https://example.com/expand-active", "status": "active", "owner": false}, stranger[0])
+	assert.Equal(t, map[string]interface{}{"short_url": testConfig.FlagBaseURL + deleted, "status": "deleted", "owner": false}, stranger[1])
+	assert.Equal(t, map[string]interface{}{"short_url": testConfig.FlagBaseURL + expired, "status": "expired", "owner": false}, stranger[2])
+	assert.Equal(t, map[string]interface{}{"short_url": testConfig.FlagBaseURL + "missing-code", "status": "not_found", "owner": false}, stranger[3])
+	assert.Equal(t, map[string]interface{}{"short_url": "a/b", "status": "invalid", "owner": false}, stranger[4])
+
+	own := expand(owner)
+	assert.Equal(t, true, own[1]["owner"])
+	assert.Equal(t, "https://example.com/expand-deleted", own[1]["original_url"])
+	assert.Equal(t, "expired", own[2]["status"])
+	assert.NotEmpty(t, own[2]["expires_at"])
+
+	req := httptest.NewRequest(http.MethodPost, "/api/expand/batch", bytes.NewBufferString(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestLookup(t *testing.T) {
+	const original = "https://example.com/lookup"
+	shorten := func(alias string) (string, []*http.Cookie) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "`+original+`", "alias": "`+alias+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		require.Equal(t, http.StatusCreated, w.Code)
+		var created Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return created.Result, w.Result().Cookies()
+	}
+	first, firstUser := shorten("lookup-first")
+	second, _ := shorten("lookup-second")
+
+	adminToken := testConfig.FlagAdminToken
+	testConfig.FlagAdminToken = "test-admin-token"
+	defer func() { testConfig.FlagAdminToken = adminToken }()
+
+	tests := []struct {
+		name    string
+		query   string
+		cookies []*http.Cookie
+		admin   string
+		want    int
+		wantURL []string
+	}{
+		{"Owner", url.QueryEscape(original), firstUser, "", http.StatusOK, []string{first}},
+		{"Stranger", url.QueryEscape(original), nil, "", http.StatusNotFound, nil},
+		{"Admin", url.QueryEscape(original), nil, "test-admin-token", http.StatusOK, []string{first, second}},
+		{"Wrong admin token", url.QueryEscape(original), nil, "guess", http.StatusNotFound, nil},
+		{"Unknown URL", url.QueryEscape("https://example.com/never-shortened"), firstUser, "", http.StatusNotFound, nil},
+		{"Invalid URL", "not-a-url", firstUser, "", http.StatusBadRequest, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/lookup?url="+tt.query, nil)
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			if tt.admin != "" {
+				req.Header.Set("X-Admin-Token", tt.admin)
+			}
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			require.Equal(t, tt.want, w.Code)
+			if tt.wantURL == nil {
+				return
+			}
+
+			var links []struct {
+				ShortURL string `json:"short_url"`
+				UserID   int    `json:"user_id"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &links))
+			got := make([]string, 0, len(links))
+			for _, link := range links {
+				got = append(got, link.ShortURL)
+				assert.Equal(t, tt.admin != "", link.UserID != 0)
+			}
+			assert.Equal(t, tt.wantURL, got)
+		})
+	}
+}
+
+// TestDedupPerUser проверяет область дедупликации по умолчанию: у каждого пользователя своя ссылка на адрес
+func TestDedupPerUser(t *testing.T) {
+	shorten := func(cookies []*http.Cookie) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/dedup-per-user"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		var created Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return w, created.Result
+	}
+
+	w, first := shorten(nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	firstUser := w.Result().Cookies()
+
+	w, again := shorten(firstUser)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, first, again)
+
+	w, second := shorten(nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEqual(t, first, second)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"short_url":"`+second+`"`)
+}
+
+func TestCanonicalDedup(t *testing.T) {
+	shorten := func(link string, cookies []*http.Cookie) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "`+link+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		var created Response
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+		return w, created.Result
+	}
+
+	w, first := shorten("http://Example.com:80/canonical?b=1&a=2", nil)
+	require.Equal(t, http.StatusCreated, w.Code)
+	owner := w.Result().Cookies()
+
+	w, again := shorten("http://example.com/canonical?a=2&b=1", owner)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, first, again)
+
+	// Пользователь видит адрес в том виде, в каком его прислал
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	for _, cookie := range owner {
+		req.AddCookie(cookie)
+	}
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"original_url":"http://Example.com:80/canonical?b=1\u0026a=2"`)
+
+	// Переход ведёт на каноническую форму
+	req = httptest.NewRequest(http.MethodGet, "/"+strings.TrimPrefix(first, testConfig.FlagBaseURL), nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "http://example.com/canonical?a=2&b=1", w.Header().Get("Location"))
+}
+
+func TestBlockedDestination(t *testing.T) {
+	// Ссылка сокращена до того, как адрес попал под списки
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://old.phishing.example/page"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+	key := strings.TrimPrefix(w.Body.String(), testConfig.FlagBaseURL)
+
+	domains := filepath.Join(t.TempDir(), "domains.txt")
+	require.NoError(t, os.WriteFile(domains, []byte("phishing.example\n"), 0644))
+	blocklist, err := vetting.NewBlocklist(domains, "", "")
+	require.NoError(t, err)
+	testConfig.Vetter = blocklist
+	defer func() { testConfig.Vetter = nil }()
+
+	// Переход по выданной ссылке блокируется, но сама ссылка не удаляется
+	req = httptest.NewRequest(http.MethodGet, "/"+key, nil)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.JSONEq(t, `{"error":"blocked_url"}`, w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/api/expand/batch", bytes.NewBufferString(`["`+key+`"]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.JSONEq(t, `[{"short_url":"`+testConfig.FlagBaseURL+key+`","status":"blocked","owner":false}]`, w.Body.String())
+
+	link, found, err := testConfig.Store.Get(context.Background(), key)
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, link.Deleted)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://login.phishing.example/bank"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.JSONEq(t, `{"error":"blocked_url","reason":"domain","match":"phishing.example"}`, w.Body.String())
+
+	req = httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("https://phishing.example/"))
+	req.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	request := `[
+		{"correlation_id":"blocked","original_url":"https://phishing.example/a"},
+		{"correlation_id":"ok","original_url":"https://example.com/not-blocked"}
+	]`
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(request))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Contains(t, w.Body.String(), `{"correlation_id":"blocked","status":"blocked","error":"blocked_url","reason":"domain"}`)
+
+	req = httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(`[{"correlation_id":"blocked","original_url":"https://phishing.example/b"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func TestShortenerChaining(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		reason string
+	}{
+		{"Own short link", testConfig.FlagBaseURL + "abcdefg", "self_reference"},
+		{"Own host in other case", "HTTP://LOCALHOST:8080/api/shorten", "self_reference"},
+		{"Other shortener", "https://bit.ly/3xYz", "shortener"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "`+tt.url+`"}`))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+			assert.Contains(t, w.Body.String(), `"reason":"`+tt.reason+`"`)
+		})
+	}
+}
+
+func TestDestinationPolicy(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		body string
+		want string
+	}{
+		{"File scheme", "/api/shorten", `{"url": "file:///etc/passwd"}`, `{"error":"scheme_not_allowed"}`},
+		{"JavaScript scheme", "/api/shorten", `{"url": "javascript://comment/%0Aalert(1)"}`, `{"error":"scheme_not_allowed"}`},
+		{"Loopback", "/api/shorten", `{"url": "http://127.0.0.1/admin"}`, `{"error":"private_destination"}`},
+		{"Metadata service", "/api/shorten", `{"url": "http://169.254.169.254/latest/meta-data"}`, `{"error":"private_destination"}`},
+		{"Too long", "/api/shorten", `{"url": "https://example.com/` + strings.Repeat("a", 4096) + `"}`, `{"error":"url_too_long"}`},
+		{"Batch", "/api/shorten/batch", `[{"correlation_id":"1","original_url":"http://10.0.0.1/"}]`,
+			`[{"correlation_id":"1","status":"invalid","error":"private_destination"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, bytes.NewBufferString(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.JSONEq(t, tt.want, w.Body.String())
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString("http://192.168.0.1/router"))
+	req.Header.Set("Content-Type", "text/plain")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"private_destination"}`, w.Body.String())
+}
+
+func TestPasswordProtected(t *testing.T) {
+	const original = "https://example.com/protected"
+	shorten := func(body string) (*httptest.ResponseRecorder, string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		var created Response
+		_ = json.Unmarshal(w.Body.Bytes(), &created)
+		return w, strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+	}
+	w, key := shorten(`{"url": "` + original + `", "password": "s3cret"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	// Ссылки с паролем не дедуплицируются: повтор получает свой код
+	w, again := shorten(`{"url": "` + original + `", "password": "other"}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEqual(t, key, again)
+
+	w, _ = shorten(`{"url": "` + original + `", "password": "` + strings.Repeat("x", 73) + `"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.JSONEq(t, `{"error":"invalid_password"}`, w.Body.String())
+
+	visit := func(cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/"+key, nil)
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	unlock := func(password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/"+key, strings.NewReader(url.Values{"password": {password}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	w = visit()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	assert.Contains(t, w.Body.String(), `action="/`+key+`"`)
+	assert.NotContains(t, w.Body.String(), original)
+
+	w = unlock("wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "<form")
+
+	w = unlock("s3cret")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, original, w.Header().Get("Location"))
+	var access *http.Cookie
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == "link_access" {
+			access = cookie
+		}
+	}
+	require.NotNil(t, access)
+	assert.Equal(t, "/"+key, access.Path)
+	assert.True(t, access.HttpOnly)
+
+	w = visit(access)
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, original, w.Header().Get("Location"))
+	// Доступ к одной ссылке не открывает другую
+	req := httptest.NewRequest(http.MethodGet, "/"+again, nil)
+	req.AddCookie(access)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Доступ к ссылке подписан тем же ключом, но не годится как токен пользователя
+	req = httptest.NewRequest(http.MethodGet, "/api/user/urls", nil)
+	req.AddCookie(&http.Cookie{Name: "jwt", Value: access.Value})
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// Посторонний не видит адрес защищённой ссылки в /api/expand/batch
+	req = httptest.NewRequest(http.MethodPost, "/api/expand/batch", bytes.NewBufferString(`["`+key+`"]`))
+	req.Header.Set("Content-Type", "application/json")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.JSONEq(t, `[{"short_url":"`+testConfig.FlagBaseURL+key+`","status":"active","owner":false,"protected":true}]`, w.Body.String())
+
+	// Попытки ограничены по ссылке: после исчерпания отклоняется и верный пароль
+	for i := 2; i < testConfig.FlagPasswordAttempts; i++ {
+		assert.Equal(t, http.StatusUnauthorized, unlock("wrong").Code)
+	}
+	assert.Equal(t, http.StatusTooManyRequests, unlock("wrong").Code)
+	assert.Equal(t, http.StatusTooManyRequests, unlock("s3cret").Code)
+}
+
+func TestUpdateUserURL(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/before-update"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	key := strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+	owner := w.Result().Cookies()
+
+	tests := []struct {
+		name        string
+		cookies     []*http.Cookie
+		request     string
+		want        int
+		wantPattern string
+	}{
+		{"Foreign user", nil, `{"url": "https://example.com/hijacked"}`, http.StatusForbidden, ""},
+		{"Empty update", owner, `{}`, http.StatusBadRequest, ""},
+		{"Invalid URL", owner, `{"url": "not a url"}`, http.StatusBadRequest, ""},
+		{"Owner", owner, `{"url": "https://example.com/after-update", "title": "Updated"}`, http.StatusOK, `"title":"Updated"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/"+key, bytes.NewBufferString(tt.request))
+			req.Header.Set("Content-Type", "application/json")
+			for _, cookie := range tt.cookies {
+				req.AddCookie(cookie)
+			}
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.Regexp(t, tt.wantPattern, w.Body.String())
+		})
+	}
+
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "https://example.com/after-update", w.Header().Get("Location"))
+}
+
+func TestURLHistoryRollback(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url": "https://example.com/v0"}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created Response
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	key := strings.TrimPrefix(created.Result, testConfig.FlagBaseURL)
+	owner := w.Result().Cookies()
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		for _, cookie := range owner {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusOK, do(http.MethodPatch, "/api/user/urls/"+key, `{"url": "https://example.com/v1"}`).Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPatch, "/api/user/urls/"+key, `{"url": "https://example.com/v2"}`).Code)
+
+	var history []struct {
+		Version int    `json:"version"`
+		OldURL  string `json:"old_url"`
+		NewURL  string `json:"new_url"`
+	}
+	w = do(http.MethodGet, "/api/user/urls/"+key+"/history", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 2)
+
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPost, "/api/user/urls/"+key+"/rollback?version=abc", "").Code)
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPost, "/api/user/urls/"+key+"/rollback?version=10", "").Code)
+	assert.Equal(t, http.StatusOK, do(http.MethodPost, "/api/user/urls/"+key+"/rollback?version=1", "").Code)
+
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/"+key, nil))
+	assert.Equal(t, "https://example.com/v0", w.Header().Get("Location"))
+
+	w = do(http.MethodGet, "/api/user/urls/"+key+"/history", "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &history))
+	assert.Len(t, history, 3)
+	assert.Equal(t, "https://example.com/v0", history[2].NewURL)
+}
+
+func TestGRPC(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpcserver.New(testConfig)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+	client := pb.NewShortenerClient(conn)
+	ctx := context.Background()
+
+	var header metadata.MD
+	shortened, err := client.Shorten(ctx, &pb.ShortenRequest{Url: "https://example.com/grpc"}, grpc.Header(&header))
+	require.NoError(t, err)
+	assert.Regexp(t, `^http://localhost:8080/[a-zA-Z0-9]{7}$`, shortened.GetResult())
+	require.NotEmpty(t, header.Get("authorization"))
+	authCtx := metadata.AppendToOutgoingContext(ctx, "authorization", header.Get("authorization")[0])
+
+	_, err = client.Shorten(ctx, &pb.ShortenRequest{Url: "not a url"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	resolved, err := client.Resolve(ctx, &pb.ResolveRequest{ShortCode: shortened.GetResult()})
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/grpc", resolved.GetOriginalUrl())
+	// Раскрытие через gRPC учитывается в статистике так же, как переход по HTTP
+	assert.Eventually(t, func() bool {
+		stats, err := testConfig.Store.GetLinkStats(ctx, strings.TrimPrefix(shortened.GetResult(), testConfig.FlagBaseURL))
+		return err == nil && stats.TotalClicks == 1
+	}, 3*time.Second, 50*time.Millisecond)
+
+	batch, err := client.ShortenBatch(authCtx, &pb.ShortenBatchRequest{Items: []*pb.BatchItem{
+		{CorrelationId: "1", OriginalUrl: "https://example.com/grpc-batch"},
+	}})
+	require.NoError(t, err)
+	require.Len(t, batch.GetItems(), 1)
+
+	list, err := client.ListUserURLs(authCtx, &pb.ListUserURLsRequest{})
+	require.NoError(t, err)
+	assert.Len(t, list.GetUrls(), 2)
+
+	_, err = client.DeleteUserURLs(authCtx, &pb.DeleteUserURLsRequest{ShortCodes: []string{shortened.GetResult()}})
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		_, err := client.Resolve(ctx, &pb.ResolveRequest{ShortCode: shortened.GetResult()})
+		return status.Code(err) == codes.NotFound
+	}, 3*time.Second, 50*time.Millisecond)
+
+	badCtx := metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer garbage")
+	_, err = client.ListUserURLs(badCtx, &pb.ListUserURLsRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestMigrateRequiresDatabase(t *testing.T) {
+	var out bytes.Buffer
+	cfg := &config.Config{}
+	err := runMigrate(context.Background(), cfg, []string{"status"}, &out)
+	assert.ErrorContains(t, err, "PostgreSQL")
+
+	cfg.FlagForDB = "postgres://localhost/db"
+	assert.ErrorContains(t, runMigrate(context.Background(), cfg, []string{"sideways"}, &out), "usage")
+	assert.ErrorContains(t, runMigrate(context.Background(), cfg, []string{"up", "x"}, &out), "некорректная версия")
+}
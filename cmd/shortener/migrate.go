@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+)
+
+const migrateUsage = "usage: shortener -d DSN migrate [up [VERSION] | down [VERSION] | status]"
+
+// runMigrate применяет, откатывает или показывает миграции схемы PostgreSQL без запуска сервера.
+// up без версии применяет все миграции и область дедупликации, down без версии откатывает последнюю.
+func runMigrate(ctx context.Context, cfg *config.Config, args []string, out io.Writer) error {
+	if cfg.FlagForDB == "" {
+		return errors.New("миграции применяются только к PostgreSQL, укажите -d или DATABASE_DSN")
+	}
+	command := "up"
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+	if len(args) > 1 {
+		return errors.New(migrateUsage)
+	}
+	version := -1
+	if len(args) == 1 {
+		parsed, err := strconv.Atoi(args[0])
+		if err != nil || parsed < 0 {
+			return fmt.Errorf("некорректная версия %q", args[0])
+		}
+		version = parsed
+	}
+
+	store, err := storage.OpenPostgresStorage(ctx, cfg.FlagForDB, cfg.PoolConfig())
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	switch command {
+	case "up":
+		if version < 0 {
+			version = 0
+		}
+		applied, err := store.MigrateUp(ctx, version)
+		for _, migration := range applied {
+			fmt.Fprintf(out, "applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		if err != nil || version != 0 {
+			return err
+		}
+		// Пересчёт ключей под новую область блокирует таблицу ссылок, поэтому его лучше выполнить здесь:
+		// реплики, запущенные потом с той же областью, ключи уже не пересчитывают
+		dedup, err := storage.ParseDedupScope(cfg.FlagDedupScope)
+		if err != nil {
+			return fmt.Errorf("%w: %q", err, cfg.FlagDedupScope)
+		}
+		if err := store.SetDedupScope(ctx, dedup); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "dedup scope: %s\n", dedup)
+		return nil
+	case "down":
+		if version < 0 {
+			current, err := currentVersion(ctx, store)
+			if err != nil {
+				return err
+			}
+			version = max(current-1, 0)
+		}
+		reverted, err := store.MigrateDown(ctx, version)
+		for _, migration := range reverted {
+			fmt.Fprintf(out, "reverted %04d_%s\n", migration.Version, migration.Name)
+		}
+		return err
+	case "status":
+		if version >= 0 {
+			return errors.New(migrateUsage)
+		}
+		statuses, err := store.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", status.Version, status.Name, applied)
+		}
+		return nil
+	default:
+		return errors.New(migrateUsage)
+	}
+}
+
+func currentVersion(ctx context.Context, store *storage.PostgresStorage) (int, error) {
+	statuses, err := store.MigrationStatus(ctx)
+	if err != nil {
+		return 0, err
+	}
+	current := 0
+	for _, status := range statuses {
+		if status.AppliedAt != nil {
+			current = status.Version
+		}
+	}
+	return current, nil
+}
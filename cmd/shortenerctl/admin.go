@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+)
+
+type adminCommand func(ctx context.Context, cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error
+
+var adminCommands = map[string]adminCommand{
+	"count":   countCommand,
+	"dump":    dumpCommand,
+	"import":  importCommand,
+	"migrate": migrateCommand,
+}
+
+func countCommand(ctx context.Context, cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) != 0 {
+		return errors.New("usage: count")
+	}
+	fmt.Fprintln(stdout, cfg.Store.Len(ctx))
+	return nil
+}
+
+func dumpCommand(ctx context.Context, cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) > 1 {
+		return errors.New("usage: dump [FILE]")
+	}
+	output := stdout
+	if len(args) == 1 && args[0] != "-" {
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		output = file
+	}
+	_, err := storage.DumpLinks(ctx, cfg.Store, output)
+	return err
+}
+
+// importCommand загружает выгрузку в хранилище и дописывает её в журнал,
+// чтобы in-memory хранилище восстановило ссылки при следующем запуске сервера
+func importCommand(ctx context.Context, cfg *config.Config, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: import FILE")
+	}
+	input := stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	var journal io.Writer
+	if cfg.File != nil {
+		journal = cfg.File
+	}
+
+	before := cfg.Store.Len(ctx)
+	if err := storage.ReplayLinks(ctx, cfg.Store, input, journal); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "imported %d link(s)\n", cfg.Store.Len(ctx)-before)
+	return nil
+}
+
+// migrateCommand переносит ссылки и пользователей из настроенного хранилища в другое.
+// Последний перенесённый код сохраняется в файл -checkpoint, и следующий запуск продолжает с него.
+func migrateCommand(ctx context.Context, cfg *config.Config, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	toDB := flags.String("to-db", "", "PostgreSQL connection string of the target storage")
+	toFile := flags.String("to-file", "", "path of the target file journal")
+	dryRun := flags.Bool("dry-run", false, "report what would be migrated without writing")
+	checkpointPath := flags.String("checkpoint", "", "file to save progress to and resume from")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if (*toDB == "") == (*toFile == "") || flags.NArg() != 0 {
+		return errors.New("usage: migrate -to-db DSN | -to-file PATH [-dry-run] [-checkpoint FILE]")
+	}
+
+	opts := storage.MigrateOptions{DryRun: *dryRun, CheckpointEvery: 100}
+	if *checkpointPath != "" {
+		data, err := os.ReadFile(*checkpointPath)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		opts.After = strings.TrimSpace(string(data))
+		opts.Checkpoint = func(short string) error {
+			return os.WriteFile(*checkpointPath, []byte(short+"\n"), 0644)
+		}
+	}
+
+	var target storage.Storage
+	if *toDB != "" {
+		pgStorage, err := storage.NewPostgresStorage(ctx, *toDB, cfg.PoolConfig())
+		if err != nil {
+			return fmt.Errorf("ошибка подключения к целевой БД: %w", err)
+		}
+		defer pgStorage.Close()
+		target = pgStorage
+	} else {
+		// Уже перенесённые ссылки восстанавливаем из целевого журнала, чтобы не записать их повторно
+		target = storage.NewLinkStorage()
+		if err := storage.LoadLinksFromFile(ctx, target, *toFile); err != nil {
+			return err
+		}
+		if !*dryRun {
+			journal, err := os.OpenFile(*toFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+			if err != nil {
+				return err
+			}
+			defer journal.Close()
+			opts.Journal = journal
+		}
+	}
+
+	dedup, err := storage.ParseDedupScope(cfg.FlagDedupScope)
+	if err != nil {
+		return fmt.Errorf("%w: %q", err, cfg.FlagDedupScope)
+	}
+	if err := target.SetDedupScope(ctx, dedup); err != nil {
+		return err
+	}
+
+	if opts.After != "" {
+		fmt.Fprintf(stdout, "resuming after %s\n", opts.After)
+	}
+	report, err := storage.Migrate(ctx, cfg.Store, target, opts)
+	if report != nil {
+		for _, conflict := range report.Conflicts {
+			fmt.Fprintf(stdout, "conflict\t%s\t%s\t%s\n", conflict.ShortURL, conflict.OriginalURL, conflict.Reason)
+		}
+		prefix := ""
+		if *dryRun {
+			prefix = "dry run: "
+		}
+		fmt.Fprintf(stdout, "%susers: %d, links: %d, skipped: %d, conflicts: %d\n",
+			prefix, report.Users, report.Links, report.Skipped, len(report.Conflicts))
+	}
+	return err
+}
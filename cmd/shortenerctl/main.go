@@ -0,0 +1,94 @@
+// shortenerctl — клиент командной строки и инструмент администратора сервиса.
+//
+// Команды, работающие с сервером по HTTP (адрес сервера — флаг -b):
+//
+//	shorten [-alias A] [-ttl D] URL   сократить адрес
+//	batch FILE                        сократить адреса из файла, по одному в строке ("-" — stdin)
+//	list                              ссылки пользователя
+//	delete KEY...                     удалить ссылки пользователя
+//	stats KEY                         статистика переходов
+//
+// Офлайн-команды работают напрямую с хранилищем (флаги -d и -f):
+//
+//	count                             число ссылок
+//	dump [FILE]                       выгрузить ссылки в формате журнала (по умолчанию stdout)
+//	import FILE                       загрузить ссылки из выгрузки ("-" — stdin)
+//	migrate -to-db DSN | -to-file PATH [-dry-run] [-checkpoint FILE]
+//	                                  перенести ссылки и пользователей в другое хранилище
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/pkg/client"
+
+	"go.uber.org/zap"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg := &config.Config{CharsetLength: 7}
+	logger, err := zap.NewDevelopment()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "shortenerctl: ошибка инициализации логгера:", err)
+		os.Exit(1)
+	}
+	cfg.Sugar = logger.Sugar()
+
+	token := flag.String("token", os.Getenv("SHORTENER_TOKEN"), "JWT of the user, a new user is registered if empty")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: shortenerctl [flags] shorten|batch|list|delete|stats|count|dump|import|migrate [args]")
+		flag.PrintDefaults()
+	}
+	// Остальные флаги и переменные окружения разбираем так же, как сервер
+	config.ParseFlags(cfg)
+
+	if err := run(ctx, cfg, *token, flag.Args(), os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "shortenerctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, cfg *config.Config, token string, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("не указана команда, см. shortenerctl -h")
+	}
+	command, commandArgs := args[0], args[1:]
+
+	if admin, ok := adminCommands[command]; ok {
+		if err := config.OpenStore(ctx, cfg); err != nil {
+			return fmt.Errorf("ошибка открытия хранилища: %w", err)
+		}
+		if cfg.File != nil {
+			defer cfg.File.Close()
+		}
+		return admin(ctx, cfg, commandArgs, stdin, stdout)
+	}
+
+	if remote, ok := remoteCommands[command]; ok {
+		c, err := client.New(cfg.FlagBaseURL)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			c.SetToken(token)
+		}
+		err = remote(ctx, c, commandArgs, stdin, stdout)
+		// Сервер мог зарегистрировать нового пользователя — сообщаем его токен
+		if issued := c.Token(); issued != "" && issued != token {
+			fmt.Fprintln(stderr, "token:", issued)
+		}
+		return err
+	}
+
+	return fmt.Errorf("неизвестная команда %q", command)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/handlers"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+var testServer *httptest.Server
+
+func TestMain(m *testing.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg, err := config.LoadConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	router := gin.New()
+	handlers.SetupRoutes(router, cfg)
+	testServer = httptest.NewServer(router)
+	cfg.FlagBaseURL = testServer.URL + "/"
+
+	code := m.Run()
+	testServer.Close()
+	os.Exit(code)
+}
+
+func runCommand(t *testing.T, cfg *config.Config, token string, stdin string, args ...string) (string, string) {
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), cfg, token, args, strings.NewReader(stdin), &stdout, &stderr)
+	require.NoError(t, err, stderr.String())
+	return stdout.String(), stderr.String()
+}
+
+func TestRemoteCommands(t *testing.T) {
+	cfg := &config.Config{FlagBaseURL: testServer.URL + "/"}
+
+	out, errOut := runCommand(t, cfg, "", "", "shorten", "https://ctl.example.com/one")
+	short := strings.TrimSpace(out)
+	assert.True(t, strings.HasPrefix(short, testServer.URL+"/"))
+	require.True(t, strings.HasPrefix(errOut, "token: "))
+	token := strings.TrimSpace(strings.TrimPrefix(errOut, "token: "))
+
+	out, errOut = runCommand(t, cfg, token, "https://ctl.example.com/two\n\n# comment\nhttps://ctl.example.com/three\n", "batch", "-")
+	assert.Empty(t, errOut, "token should be reused")
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 2)
+	assert.Contains(t, out, "https://ctl.example.com/three")
+
+	out, _ = runCommand(t, cfg, token, "", "list")
+	assert.Len(t, strings.Split(strings.TrimSpace(out), "\n"), 3)
+	assert.Contains(t, out, short+"\thttps://ctl.example.com/one")
+
+	out, _ = runCommand(t, cfg, token, "", "stats", short)
+	assert.Contains(t, out, "total clicks:\t0")
+
+	out, _ = runCommand(t, cfg, token, "", "delete", short)
+	assert.Contains(t, out, "1 link(s)")
+	assert.Eventually(t, func() bool {
+		out, _ := runCommand(t, cfg, token, "", "list")
+		return len(strings.Split(strings.TrimSpace(out), "\n")) == 2
+	}, 3*time.Second, 50*time.Millisecond)
+}
+
+func TestAdminCommands(t *testing.T) {
+	dir := t.TempDir()
+	newConfig := func(journal string) *config.Config {
+		return &config.Config{Sugar: zap.NewNop().Sugar(), FlagPathToSave: filepath.Join(dir, journal)}
+	}
+
+	dump := strings.Join([]string{
+		`{"uuid":"1","short_url":"aaa","original_url":"https://ctl.example.com/a","user_id":1}`,
+		`{"uuid":"2","short_url":"bbb","original_url":"https://ctl.example.com/b","user_id":1}`,
+		`{"uuid":"","short_url":"bbb","original_url":"","user_id":1,"title":"B","is_updated":true}`,
+		`{"uuid":"3","short_url":"ccc","original_url":"https://ctl.example.com/c","user_id":2}`,
+		`{"uuid":"","short_url":"ccc","original_url":"","user_id":2,"is_deleted":true}`,
+	}, "\n") + "\n"
+
+	out, _ := runCommand(t, newConfig("source.txt"), "", dump, "import", "-")
+	assert.Equal(t, "imported 3 link(s)\n", out)
+
+	// Импорт записан в журнал, поэтому новое открытие хранилища видит те же ссылки
+	out, _ = runCommand(t, newConfig("source.txt"), "", "", "count")
+	assert.Equal(t, "3\n", out)
+
+	out, _ = runCommand(t, newConfig("source.txt"), "", "", "dump")
+	assert.Equal(t, dump, out)
+
+	dumpFile := filepath.Join(dir, "dump.jsonl")
+	runCommand(t, newConfig("source.txt"), "", "", "dump", dumpFile)
+	out, _ = runCommand(t, newConfig("target.txt"), "", "", "import", dumpFile)
+	assert.Equal(t, "imported 3 link(s)\n", out)
+	out, _ = runCommand(t, newConfig("target.txt"), "", "", "dump")
+	assert.Equal(t, dump, out)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), &config.Config{}, "", []string{"frobnicate"}, strings.NewReader(""), &stdout, &stderr)
+	assert.ErrorContains(t, err, "frobnicate")
+	err = run(context.Background(), &config.Config{}, "", nil, strings.NewReader(""), &stdout, &stderr)
+	assert.Error(t, err)
+}
+
+func TestMigrateCommand(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.txt")
+	target := filepath.Join(dir, "target.txt")
+	checkpoint := filepath.Join(dir, "checkpoint")
+	cfg := func() *config.Config {
+		return &config.Config{Sugar: zap.NewNop().Sugar(), FlagPathToSave: source}
+	}
+
+	require.NoError(t, os.WriteFile(source, []byte(strings.Join([]string{
+		`{"uuid":"u1","short_url":"aaa","original_url":"https://ctl.example.com/a","user_id":3}`,
+		`{"uuid":"u2","short_url":"bbb","original_url":"https://ctl.example.com/b","user_id":7}`,
+		`{"uuid":"u3","short_url":"ccc","original_url":"https://ctl.example.com/c","user_id":7}`,
+		`{"short_url":"ccc","user_id":7,"is_deleted":true}`,
+		`{"uuid":"u4","short_url":"ddd","original_url":"https://ctl.example.com/d","user_id":3}`,
+	}, "\n")+"\n"), 0644))
+	// В целевом журнале код ddd уже занят другой ссылкой
+	require.NoError(t, os.WriteFile(target, []byte(
+		`{"uuid":"x","short_url":"ddd","original_url":"https://ctl.example.com/other","user_id":1}`+"\n"), 0644))
+
+	out, _ := runCommand(t, cfg(), "", "", "migrate", "-to-file", target, "-dry-run", "-checkpoint", checkpoint)
+	assert.Contains(t, out, "conflict\tddd\thttps://ctl.example.com/d\tshort code already points to https://ctl.example.com/other")
+	assert.Contains(t, out, "dry run: users: 2, links: 3, skipped: 0, conflicts: 1")
+	assert.NoFileExists(t, checkpoint)
+
+	// Прерванный перенос: aaa уже перенесён
+	require.NoError(t, os.WriteFile(checkpoint, []byte("aaa\n"), 0644))
+	out, _ = runCommand(t, cfg(), "", "", "migrate", "-to-file", target, "-checkpoint", checkpoint)
+	assert.Contains(t, out, "resuming after aaa")
+	assert.Contains(t, out, "links: 2, skipped: 0, conflicts: 1")
+	data, err := os.ReadFile(checkpoint)
+	require.NoError(t, err)
+	assert.Equal(t, "ddd\n", string(data))
+
+	// Без контрольной точки уже перенесённые ссылки пропускаются
+	out, _ = runCommand(t, cfg(), "", "", "migrate", "-to-file", target)
+	assert.Contains(t, out, "links: 1, skipped: 2, conflicts: 1")
+
+	out, _ = runCommand(t, &config.Config{Sugar: zap.NewNop().Sugar(), FlagPathToSave: target}, "", "", "dump")
+	assert.Equal(t, strings.Join([]string{
+		`{"uuid":"u1","short_url":"aaa","original_url":"https://ctl.example.com/a","user_id":3}`,
+		`{"uuid":"u2","short_url":"bbb","original_url":"https://ctl.example.com/b","user_id":7}`,
+		`{"uuid":"u3","short_url":"ccc","original_url":"https://ctl.example.com/c","user_id":7}`,
+		`{"uuid":"","short_url":"ccc","original_url":"","user_id":7,"is_deleted":true}`,
+		`{"uuid":"x","short_url":"ddd","original_url":"https://ctl.example.com/other","user_id":1}`,
+	}, "\n")+"\n", out)
+}
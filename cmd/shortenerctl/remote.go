@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/pkg/client"
+)
+
+type remoteCommand func(ctx context.Context, c *client.Client, args []string, stdin io.Reader, stdout io.Writer) error
+
+var remoteCommands = map[string]remoteCommand{
+	"shorten": shortenCommand,
+	"batch":   batchCommand,
+	"list":    listCommand,
+	"delete":  deleteCommand,
+	"stats":   statsCommand,
+}
+
+func shortenCommand(ctx context.Context, c *client.Client, args []string, _ io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("shorten", flag.ContinueOnError)
+	alias := flags.String("alias", "", "custom short code")
+	ttl := flags.Duration("ttl", 0, "link lifetime, unlimited if zero")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("usage: shorten [-alias A] [-ttl D] URL")
+	}
+
+	short, err := c.Shorten(ctx, flags.Arg(0), &client.ShortenOptions{Alias: *alias, TTLSeconds: int(ttl.Seconds())})
+	var conflict *client.ConflictError
+	if errors.As(err, &conflict) && conflict.ShortURL != "" {
+		// Адрес уже сокращён — это не ошибка для пользователя
+		fmt.Fprintln(stdout, conflict.ShortURL)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(stdout, short)
+	return nil
+}
+
+func batchCommand(ctx context.Context, c *client.Client, args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: batch FILE")
+	}
+	input := stdin
+	if args[0] != "-" {
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+
+	var items []client.BatchItem
+	originals := map[string]string{}
+	scanner := bufio.NewScanner(input)
+	for line := 1; scanner.Scan(); line++ {
+		original := strings.TrimSpace(scanner.Text())
+		if original == "" || strings.HasPrefix(original, "#") {
+			continue
+		}
+		id := strconv.Itoa(line)
+		items = append(items, client.BatchItem{CorrelationID: id, OriginalURL: original})
+		originals[id] = original
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return errors.New("в файле нет адресов")
+	}
+
+	results, err := c.ShortenBatch(ctx, items)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, result := range results {
+		switch result.Status {
+		case "created", "exists":
+			fmt.Fprintf(stdout, "%s\t%s\n", result.ShortURL, originals[result.CorrelationID])
+		default:
+			failed++
+			fmt.Fprintf(stdout, "%s\t%s\t%s\n", result.Status, originals[result.CorrelationID], result.Error)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d URL(s) were not shortened", failed, len(results))
+	}
+	return nil
+}
+
+func listCommand(ctx context.Context, c *client.Client, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) != 0 {
+		return errors.New("usage: list")
+	}
+	urls, err := c.UserURLs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, url := range urls {
+		fmt.Fprintf(stdout, "%s\t%s\n", url.ShortURL, url.OriginalURL)
+	}
+	return nil
+}
+
+func deleteCommand(ctx context.Context, c *client.Client, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("usage: delete KEY...")
+	}
+	if err := c.DeleteUserURLs(ctx, args); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "%d link(s) queued for deletion\n", len(args))
+	return nil
+}
+
+func statsCommand(ctx context.Context, c *client.Client, args []string, _ io.Reader, stdout io.Writer) error {
+	if len(args) != 1 {
+		return errors.New("usage: stats KEY")
+	}
+	stats, err := c.Stats(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "total clicks:\t%d\nunique visitors:\t%d\n", stats.TotalClicks, stats.UniqueVisitors)
+	for _, day := range stats.Daily {
+		fmt.Fprintf(stdout, "%s\t%d\n", day.Date, day.Clicks)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package analytics
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	jwtauth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+const (
+	batchSize     = 100
+	flushInterval = time.Second
+	queueSize     = 4096
+)
+
+// Recorder копит переходы по ссылкам и пишет их в хранилище в фоне,
+// чтобы редирект не ждал записи в базу.
+// Если journal не nil, записанные переходы дописываются в него, как удаления в Deleter.
+type Recorder struct {
+	store   storage.Storage
+	journal io.Writer
+	sugar   *zap.SugaredLogger
+	clicks  chan storage.Click
+	done    chan struct{}
+	once    sync.Once
+}
+
+func NewRecorder(store storage.Storage, journal io.Writer, sugar *zap.SugaredLogger) *Recorder {
+	r := &Recorder{
+		store:   store,
+		journal: journal,
+		sugar:   sugar,
+		clicks:  make(chan storage.Click, queueSize),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record ставит переход в очередь. Если очередь переполнена, переход теряется.
+func (r *Recorder) Record(click storage.Click) {
+	select {
+	case r.clicks <- click:
+	default:
+		r.sugar.Warn("Очередь аналитики переполнена, переход не записан:", click.ShortURL)
+	}
+}
+
+// Close сбрасывает накопленные переходы и останавливает воркер
+func (r *Recorder) Close() {
+	r.once.Do(func() {
+		close(r.clicks)
+		<-r.done
+	})
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	var batch []storage.Click
+	for {
+		select {
+		case click, ok := <-r.clicks:
+			if !ok {
+				r.flush(batch)
+				return
+			}
+			batch = append(batch, click)
+			if len(batch) < batchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		r.flush(batch)
+		batch = nil
+	}
+}
+
+func (r *Recorder) flush(batch []storage.Click) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := r.store.SaveClicks(ctx, batch); err != nil {
+		r.sugar.Error("Ошибка сохранения переходов:", err)
+		return
+	}
+
+	if r.journal == nil {
+		return
+	}
+	encoder := json.NewEncoder(r.journal)
+	for _, click := range batch {
+		if err := encoder.Encode(storage.ClickRecord(click)); err != nil {
+			r.sugar.Error("Ошибка записи перехода в файл:", err)
+			return
+		}
+	}
+}
+
+// HashIP возвращает подписанный хеш IP-адреса, чтобы не хранить адреса в открытом виде
+func HashIP(ip string) string {
+	mac := hmac.New(sha256.New, []byte(jwtauth.SecretKEY))
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,38 @@
+package analytics
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRecorderJournal(t *testing.T) {
+	ctx := context.Background()
+	store := storage.NewLinkStorage()
+	var journal bytes.Buffer
+	recorder := NewRecorder(store, &journal, zap.NewNop().Sugar())
+
+	now := time.Now()
+	recorder.Record(storage.Click{ShortURL: "clicked", Time: now, IPHash: HashIP("192.0.2.1")})
+	recorder.Record(storage.Click{ShortURL: "clicked", Time: now, IPHash: HashIP("192.0.2.2"), Referrer: "https://example.com/"})
+	// Close сбрасывает переходы, ещё не дождавшиеся очередной записи
+	recorder.Close()
+
+	stats, err := store.GetLinkStats(ctx, "clicked")
+	require.NoError(t, err)
+	assert.Equal(t, 2, stats.TotalClicks)
+
+	// После перезапуска статистика восстанавливается из журнала
+	restarted := storage.NewLinkStorage()
+	require.NoError(t, storage.ReplayLinks(ctx, restarted, &journal, nil))
+	restored, err := restarted.GetLinkStats(ctx, "clicked")
+	require.NoError(t, err)
+	assert.Equal(t, stats, restored)
+}
@@ -0,0 +1,166 @@
+// Package canonical приводит адреса к канонической форме, чтобы одинаковые по смыслу
+// адреса сокращались в одну ссылку.
+package canonical
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// Правила канонизации, их набор задаётся флагом -canonical-rules
+const (
+	// RuleLowercase приводит схему и хост к нижнему регистру
+	RuleLowercase = "lowercase"
+	// RuleDefaultPort убирает порт 80 у http и 443 у https
+	RuleDefaultPort = "default-port"
+	// RuleIDN переводит интернационализированный хост в punycode
+	RuleIDN = "idn"
+	// RuleSortQuery сортирует параметры запроса по имени
+	RuleSortQuery = "sort-query"
+	// RuleStripTracking убирает параметры отслеживания вроде utm_* и fbclid
+	RuleStripTracking = "strip-tracking"
+)
+
+// DefaultRules — правила, которые не меняют адрес назначения по смыслу
+var DefaultRules = []string{RuleLowercase, RuleDefaultPort, RuleIDN, RuleSortQuery}
+
+// DefaultTrackingParams — параметры для RuleStripTracking. Звёздочка в конце означает префикс.
+var DefaultTrackingParams = []string{"utm_*", "fbclid", "gclid", "yclid", "mc_eid"}
+
+var (
+	ErrUnknownRule = errors.New("неизвестное правило канонизации")
+	ErrInvalidURL  = errors.New("некорректный адрес")
+)
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Canonicalizer применяет к адресам выбранный набор правил
+type Canonicalizer struct {
+	rules    map[string]bool
+	tracking []string
+}
+
+// New создаёт Canonicalizer с правилами rules и параметрами отслеживания tracking
+func New(rules []string, tracking []string) (*Canonicalizer, error) {
+	c := &Canonicalizer{rules: map[string]bool{}, tracking: tracking}
+	for _, rule := range rules {
+		switch rule {
+		case RuleLowercase, RuleDefaultPort, RuleIDN, RuleSortQuery, RuleStripTracking:
+			c.rules[rule] = true
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnknownRule, rule)
+		}
+	}
+	return c, nil
+}
+
+// ParseList разбирает значение флага со списком через запятую. "none" — пустой список.
+func ParseList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" && item != "none" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Canonicalize проверяет адрес так же, как url.ParseRequestURI, и приводит его к канонической форме
+func (c *Canonicalizer) Canonicalize(raw string) (string, error) {
+	if _, err := url.ParseRequestURI(raw); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+
+	if u.Host != "" {
+		u.Host = c.host(u.Scheme, u.Host)
+	}
+	if c.rules[RuleLowercase] {
+		u.Scheme = strings.ToLower(u.Scheme)
+	}
+	if u.RawQuery != "" && (c.rules[RuleSortQuery] || c.rules[RuleStripTracking]) {
+		u.RawQuery = c.query(u.RawQuery)
+	}
+	return u.String(), nil
+}
+
+func (c *Canonicalizer) host(scheme, hostport string) string {
+	host, port := hostport, ""
+	if h, p, err := net.SplitHostPort(hostport); err == nil {
+		host, port = h, p
+	}
+	// IPv6-адрес не трогаем, кроме порта
+	ipv6 := strings.Contains(host, ":")
+
+	if c.rules[RuleIDN] && !ipv6 {
+		// Хост, который idna не принимает (например, с подчёркиванием), оставляем как есть
+		if ascii, err := idna.Lookup.ToASCII(host); err == nil {
+			host = ascii
+		}
+	}
+	if c.rules[RuleLowercase] {
+		host = strings.ToLower(host)
+	}
+	if c.rules[RuleDefaultPort] && port == defaultPorts[strings.ToLower(scheme)] {
+		port = ""
+	}
+
+	if ipv6 {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		return host + ":" + port
+	}
+	return host
+}
+
+// query убирает параметры отслеживания и сортирует остальные по имени.
+// Значения не перекодируются, порядок значений одного параметра сохраняется.
+func (c *Canonicalizer) query(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+	kept := params[:0]
+	for _, param := range params {
+		if param == "" {
+			continue
+		}
+		if c.rules[RuleStripTracking] && c.isTracking(paramName(param)) {
+			continue
+		}
+		kept = append(kept, param)
+	}
+	if c.rules[RuleSortQuery] {
+		sort.SliceStable(kept, func(i, j int) bool { return paramName(kept[i]) < paramName(kept[j]) })
+	}
+	return strings.Join(kept, "&")
+}
+
+func (c *Canonicalizer) isTracking(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range c.tracking {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if name == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func paramName(param string) string {
+	name, _, _ := strings.Cut(param, "=")
+	if unescaped, err := url.QueryUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
@@ -0,0 +1,53 @@
+package canonical
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCanonicalize(t *testing.T) {
+	all := append(append([]string{}, DefaultRules...), RuleStripTracking)
+	tests := []struct {
+		name  string
+		rules []string
+		raw   string
+		want  string
+	}{
+		{"Default rules", DefaultRules, "http://Example.com:80/a?b=1&a=2", "http://example.com/a?a=2&b=1"},
+		{"Same link", DefaultRules, "http://example.com/a?a=2&b=1", "http://example.com/a?a=2&b=1"},
+		{"Scheme case", DefaultRules, "HTTPS://EXAMPLE.com/Path", "https://example.com/Path"},
+		{"HTTPS default port", DefaultRules, "https://example.com:443/", "https://example.com/"},
+		{"Other port kept", DefaultRules, "https://example.com:80/", "https://example.com:80/"},
+		{"IDN", DefaultRules, "https://Пример.рф/путь", "https://xn--e1afmkfd.xn--p1ai/%D0%BF%D1%83%D1%82%D1%8C"},
+		{"IPv6", DefaultRules, "http://[::1]:80/", "http://[::1]/"},
+		{"Repeated params keep order", DefaultRules, "http://example.com/?b=2&a=1&b=1", "http://example.com/?a=1&b=2&b=1"},
+		{"Tracking kept by default", DefaultRules, "http://example.com/?utm_source=x&id=1", "http://example.com/?id=1&utm_source=x"},
+		{"Tracking stripped", all, "http://example.com/?utm_source=x&id=1&fbclid=y&UTM_Medium=z", "http://example.com/?id=1"},
+		{"Only tracking", all, "http://example.com/a?utm_source=x#top", "http://example.com/a#top"},
+		{"No rules", nil, "http://Example.com:80/a?b=1&a=2", "http://Example.com:80/a?b=1&a=2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := New(tt.rules, DefaultTrackingParams)
+			require.NoError(t, err)
+			got, err := c.Canonicalize(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCanonicalizeInvalid(t *testing.T) {
+	c, err := New(DefaultRules, nil)
+	require.NoError(t, err)
+	_, err = c.Canonicalize("not a url")
+	assert.ErrorIs(t, err, ErrInvalidURL)
+
+	_, err = New([]string{"shout"}, nil)
+	assert.ErrorIs(t, err, ErrUnknownRule)
+	assert.Equal(t, []string{"idn", "sort-query"}, ParseList(" idn, ,sort-query"))
+	assert.Empty(t, ParseList("none"))
+}
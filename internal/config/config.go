@@ -3,10 +3,19 @@ package config
 import (
 	"context"
 	"fmt"
+	"io"
+	"net"
 	"os"
-	"sync"
+	"time"
 
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/analytics"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/canonical"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/generator"
+	jwtauth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/ratelimit"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 
 	"go.uber.org/zap"
 )
@@ -15,20 +24,78 @@ var Cfg *Config
 
 type (
 	Config struct {
-		Mu             sync.Mutex
-		Charset        string
-		CharsetLength  int
-		Sugar          *zap.SugaredLogger
-		File           *os.File
-		FlagRunAddr    string
-		FlagBaseURL    string
-		FlagPathToSave string
-		FlagForDB      string
-		Store          storage.Storage
+		Charset          string
+		CharsetLength    int
+		Sugar            *zap.SugaredLogger
+		File             *os.File
+		FlagRunAddr      string
+		FlagBaseURL      string
+		FlagPathToSave   string
+		FlagForDB        string
+		FlagReapInterval time.Duration
+		FlagCodeStrategy string
+		FlagGRPCAddr     string
+		FlagStreamLimit  int
+		FlagAdminToken   string
+		FlagDedupScope   string
+
+		FlagCanonicalRules string
+		FlagTrackingParams string
+
+		FlagBlocklistDomains  string
+		FlagBlocklistPatterns string
+		FlagBlocklistHashes   string
+		FlagBlocklistReload   time.Duration
+
+		FlagAllowedSchemes string
+		FlagMaxURLLength   int
+		FlagAllowedHosts   string
+		FlagBlockPrivate   bool
+		FlagResolveDNS     bool
+
+		FlagShortenerDomains string
+		FlagShortenerPolicy  string
+		FlagResolveMaxHops   int
+		FlagResolveTimeout   time.Duration
+
+		FlagPasswordAttempts int
+		FlagPasswordWindow   time.Duration
+
+		FlagDBMaxConns        int
+		FlagDBMinConns        int
+		FlagDBMaxConnLifetime time.Duration
+		FlagDBMaxConnIdleTime time.Duration
+		FlagDBConnectTimeout  time.Duration
+
+		Generator     generator.Generator
+		Canonicalizer *canonical.Canonicalizer
+		Policy        *policy.Policy
+		Vetter        vetting.Checker
+		Unwrapper     *vetting.Unwrapper
+		Store         storage.Storage
+		Deleter       *storage.Deleter
+		Recorder      *analytics.Recorder
+		Reaper        *storage.Reaper
+		Watcher       *vetting.Watcher
+		// PasswordLimiter ограничивает попытки ввода пароля ссылки, ключ — короткий код
+		PasswordLimiter *ratelimit.Limiter
 	}
 )
 
+// LoadConfig разбирает флаги и поднимает хранилище, генератор и фоновые задачи сервера
 func LoadConfig(ctx context.Context) (*Config, error) {
+	cfg, err := New()
+	if err != nil {
+		return nil, err
+	}
+	if err := Setup(ctx, cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// New создаёт конфигурацию с логгером и разбирает флаги, ничего не открывая
+func New() (*Config, error) {
 	cfg := &Config{
 		Charset:       "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ",
 		CharsetLength: 7,
@@ -41,11 +108,100 @@ func LoadConfig(ctx context.Context) (*Config, error) {
 	}
 	cfg.Sugar = logger.Sugar()
 	ParseFlags(cfg)
-	// Выбираем хранилище (PostgreSQL или in-memory)
+	return cfg, nil
+}
+
+// Setup открывает хранилище и запускает фоновые задачи сервера
+func Setup(ctx context.Context, cfg *Config) error {
+	if err := OpenStore(ctx, cfg); err != nil {
+		cfg.Sugar.Error("Ошибка подключения к БД:", err)
+	}
+
+	var journal io.Writer
+	if cfg.File != nil {
+		journal = cfg.File
+	}
+
+	// Счётчиковые стратегии берут идентификаторы блоками hi/lo, поэтому реплики не пересекаются
+	ids := generator.NewBlockAllocator(storage.NewIDBlocks(cfg.Store, journal), storage.IDBlockSize)
+	var err error
+	cfg.Generator, err = generator.New(cfg.FlagCodeStrategy, cfg.CharsetLength, cfg.Charset, []byte(jwtauth.SecretKEY), ids)
+	if err != nil {
+		return fmt.Errorf("ошибка создания генератора ссылок: %w", err)
+	}
+
+	cfg.Canonicalizer, err = canonical.New(canonical.ParseList(cfg.FlagCanonicalRules), canonical.ParseList(cfg.FlagTrackingParams))
+	if err != nil {
+		return fmt.Errorf("ошибка настройки канонизации адресов: %w", err)
+	}
+
+	cfg.Policy = &policy.Policy{
+		Schemes:      canonical.ParseList(cfg.FlagAllowedSchemes),
+		MaxLength:    cfg.FlagMaxURLLength,
+		AllowedHosts: canonical.ParseList(cfg.FlagAllowedHosts),
+		BlockPrivate: cfg.FlagBlockPrivate,
+	}
+	if cfg.FlagResolveDNS {
+		cfg.Policy.Resolver = net.DefaultResolver
+	}
+
+	cfg.PasswordLimiter = ratelimit.New(cfg.FlagPasswordAttempts, cfg.FlagPasswordWindow)
+
+	// Запускаем фоновое удаление ссылок
+	cfg.Deleter = storage.NewDeleter(cfg.Store, journal, cfg.Sugar)
+	// PostgreSQL хранит переходы сам, в памяти же они переживают перезапуск только через журнал
+	var clickJournal io.Writer
+	if _, inMemory := cfg.Store.(*storage.LinkStorage); inMemory {
+		clickJournal = journal
+	}
+	cfg.Recorder = analytics.NewRecorder(cfg.Store, clickJournal, cfg.Sugar)
+	cfg.Reaper = storage.NewReaper(cfg.Store, cfg.FlagReapInterval, cfg.Sugar)
+
+	return setupVetting(cfg)
+}
+
+// setupVetting настраивает обработку адресов других сокращателей, загружает списки
+// блокировки адресов и запускает их перечитывание. Если ни один список не задан, списки не проверяются.
+func setupVetting(cfg *Config) error {
+	policy, err := vetting.ParseShortenerPolicy(cfg.FlagShortenerPolicy)
+	if err != nil {
+		return err
+	}
+	if policy != vetting.ShortenerAllow {
+		var resolver *vetting.Resolver
+		if policy == vetting.ShortenerUnwrap {
+			resolver = vetting.NewResolver(cfg.FlagResolveMaxHops, cfg.FlagResolveTimeout)
+		}
+		cfg.Unwrapper = vetting.NewUnwrapper(canonical.ParseList(cfg.FlagShortenerDomains), policy, resolver)
+	}
+
+	if cfg.FlagBlocklistDomains == "" && cfg.FlagBlocklistPatterns == "" && cfg.FlagBlocklistHashes == "" {
+		return nil
+	}
+	blocklist, err := vetting.NewBlocklist(cfg.FlagBlocklistDomains, cfg.FlagBlocklistPatterns, cfg.FlagBlocklistHashes)
+	if err != nil {
+		return fmt.Errorf("ошибка загрузки списков блокировки: %w", err)
+	}
+	cfg.Vetter = blocklist
+	if cfg.FlagBlocklistReload > 0 {
+		cfg.Watcher = vetting.NewWatcher(blocklist, cfg.Store, cfg.FlagBlocklistReload, cfg.Sugar)
+	}
+	return nil
+}
+
+// OpenStore выбирает хранилище (PostgreSQL или in-memory), открывает журнал
+// и восстанавливает из него ссылки. Фоновые задачи сервера не запускаются.
+func OpenStore(ctx context.Context, cfg *Config) error {
+	dedup, err := storage.ParseDedupScope(cfg.FlagDedupScope)
+	if err != nil {
+		return fmt.Errorf("%w: %q", err, cfg.FlagDedupScope)
+	}
+
+	var storeErr error
 	if cfg.FlagForDB != "" {
-		pgStorage, err := storage.NewPostgresStorage(cfg.FlagForDB)
+		pgStorage, err := storage.NewPostgresStorage(ctx, cfg.FlagForDB, cfg.PoolConfig())
 		if err != nil {
-			cfg.Sugar.Error("Ошибка подключения к БД:", err)
+			storeErr = err
 		} else {
 			cfg.Store = pgStorage
 		}
@@ -54,14 +210,28 @@ func LoadConfig(ctx context.Context) (*Config, error) {
 	}
 
 	// Открываем файл для записи
-	cfg.File, err = os.OpenFile(cfg.FlagPathToSave, os.O_CREATE|os.O_RDWR, 0644)
+	cfg.File, err = os.OpenFile(cfg.FlagPathToSave, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
 	if err != nil {
 		cfg.Sugar.Errorf("Ошибка открытия файла: %v", err)
 	}
 
+	if storeErr != nil {
+		return storeErr
+	}
 	if err := storage.LoadLinksFromFile(ctx, cfg.Store, cfg.FlagPathToSave); err != nil {
 		cfg.Sugar.Error("Ошибка загрузки ссылок:", err)
 	}
+	// Область применяется после восстановления журнала: повторы, записанные при другой области, не теряются
+	return cfg.Store.SetDedupScope(ctx, dedup)
+}
 
-	return cfg, nil
+// PoolConfig собирает настройки пула соединений PostgreSQL из флагов
+func (cfg *Config) PoolConfig() storage.PoolConfig {
+	return storage.PoolConfig{
+		MaxConns:        int32(cfg.FlagDBMaxConns),
+		MinConns:        int32(cfg.FlagDBMinConns),
+		MaxConnLifetime: cfg.FlagDBMaxConnLifetime,
+		MaxConnIdleTime: cfg.FlagDBMaxConnIdleTime,
+		ConnectTimeout:  cfg.FlagDBConnectTimeout,
+	}
 }
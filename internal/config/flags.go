@@ -3,7 +3,14 @@ package config
 import (
 	"flag"
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/canonical"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 )
 
 func ParseFlags(cfg *Config) {
@@ -12,6 +19,35 @@ func ParseFlags(cfg *Config) {
 	flag.StringVar(&cfg.FlagBaseURL, "b", "http://localhost:8080", "base URL for shortened links")
 	flag.StringVar(&cfg.FlagPathToSave, "f", "default.txt", "Path to save urls JSON")
 	flag.StringVar(&cfg.FlagForDB, "d", "", "PostgreSQL connection string")
+	flag.DurationVar(&cfg.FlagReapInterval, "reap-interval", time.Minute, "interval between purges of expired links")
+	flag.StringVar(&cfg.FlagCodeStrategy, "code-strategy", "random", "short code generation strategy: random, sequential, hash or permuted")
+	flag.IntVar(&cfg.CharsetLength, "code-length", cfg.CharsetLength, "length of generated short codes")
+	flag.StringVar(&cfg.FlagGRPCAddr, "grpc-address", "", "address and port to run gRPC server, disabled when empty")
+	flag.IntVar(&cfg.FlagStreamLimit, "stream-max-items", 1_000_000, "maximum number of URLs accepted by one /api/shorten/stream request, 0 for no limit")
+	flag.StringVar(&cfg.FlagDedupScope, "dedup-scope", string(storage.DedupUser), "scope in which shortening the same URL again returns the existing link: global, user or none")
+	flag.StringVar(&cfg.FlagCanonicalRules, "canonical-rules", strings.Join(canonical.DefaultRules, ","), "URL canonicalization rules: lowercase, default-port, idn, sort-query, strip-tracking or none")
+	flag.StringVar(&cfg.FlagTrackingParams, "tracking-params", strings.Join(canonical.DefaultTrackingParams, ","), "query parameters removed by the strip-tracking rule, a trailing * matches a prefix")
+	flag.StringVar(&cfg.FlagBlocklistDomains, "blocklist-domains", "", "file with blocked domains, one per line, subdomains are blocked too")
+	flag.StringVar(&cfg.FlagBlocklistPatterns, "blocklist-patterns", "", "file with regular expressions of blocked URLs, one per line")
+	flag.StringVar(&cfg.FlagBlocklistHashes, "blocklist-hashes", "", "file with hex SHA-256 prefixes of blocked URL expressions, Safe Browsing style")
+	flag.DurationVar(&cfg.FlagBlocklistReload, "blocklist-reload", 10*time.Second, "interval between checks of blocklist files for changes, 0 to disable reloading")
+	flag.StringVar(&cfg.FlagAllowedSchemes, "allowed-schemes", strings.Join(policy.DefaultSchemes, ","), "URL schemes allowed as shortening destinations")
+	flag.IntVar(&cfg.FlagMaxURLLength, "max-url-length", policy.DefaultMaxLength, "maximum length of a destination URL in bytes, 0 for no limit")
+	flag.StringVar(&cfg.FlagAllowedHosts, "allowed-hosts", "", "comma-separated hosts allowed as destinations, subdomains included, empty to allow any host")
+	flag.BoolVar(&cfg.FlagBlockPrivate, "block-private", true, "reject loopback, private and link-local destinations")
+	flag.BoolVar(&cfg.FlagResolveDNS, "resolve-dns", false, "resolve destination host names to check them against -block-private")
+	flag.StringVar(&cfg.FlagShortenerDomains, "shortener-domains", strings.Join(vetting.DefaultShortenerDomains, ","), "domains of other URL shorteners, subdomains match too")
+	flag.StringVar(&cfg.FlagShortenerPolicy, "shortener-policy", string(vetting.ShortenerReject), "what to do with URLs of other shorteners: allow, reject or unwrap to the final destination")
+	flag.IntVar(&cfg.FlagResolveMaxHops, "resolve-max-hops", 5, "maximum number of redirects followed when unwrapping a shortener URL")
+	flag.DurationVar(&cfg.FlagResolveTimeout, "resolve-timeout", 5*time.Second, "timeout of each request made when unwrapping a shortener URL")
+	flag.IntVar(&cfg.FlagPasswordAttempts, "password-attempts", 5, "maximum number of password attempts per protected link within -password-window, 0 for no limit")
+	flag.DurationVar(&cfg.FlagPasswordWindow, "password-window", time.Minute, "window in which -password-attempts are counted")
+	flag.StringVar(&cfg.FlagAdminToken, "admin-token", "", "token for X-Admin-Token header granting access to all users' links, empty to disable")
+	flag.IntVar(&cfg.FlagDBMaxConns, "db-max-conns", 0, "maximum size of the PostgreSQL connection pool, 0 for the pgxpool default")
+	flag.IntVar(&cfg.FlagDBMinConns, "db-min-conns", 0, "minimum number of idle PostgreSQL connections kept open")
+	flag.DurationVar(&cfg.FlagDBMaxConnLifetime, "db-max-conn-lifetime", 0, "maximum lifetime of a PostgreSQL connection, 0 for the pgxpool default")
+	flag.DurationVar(&cfg.FlagDBMaxConnIdleTime, "db-max-conn-idle-time", 0, "maximum idle time of a PostgreSQL connection, 0 for the pgxpool default")
+	flag.DurationVar(&cfg.FlagDBConnectTimeout, "db-connect-timeout", 5*time.Second, "timeout for establishing a PostgreSQL connection")
 
 	// Разбираем флаги
 	flag.Parse()
@@ -29,6 +65,128 @@ func ParseFlags(cfg *Config) {
 	if envDBtoSave := os.Getenv("DATABASE_DSN"); envDBtoSave != "" {
 		cfg.FlagForDB = envDBtoSave
 	}
+	if envReapInterval := os.Getenv("REAP_INTERVAL"); envReapInterval != "" {
+		if interval, err := time.ParseDuration(envReapInterval); err == nil {
+			cfg.FlagReapInterval = interval
+		}
+	}
+	if envGRPCAddr, ok := os.LookupEnv("GRPC_ADDRESS"); ok {
+		cfg.FlagGRPCAddr = envGRPCAddr
+	}
+	if envCodeStrategy := os.Getenv("CODE_STRATEGY"); envCodeStrategy != "" {
+		cfg.FlagCodeStrategy = envCodeStrategy
+	}
+	if envCodeLength := os.Getenv("CODE_LENGTH"); envCodeLength != "" {
+		if length, err := strconv.Atoi(envCodeLength); err == nil {
+			cfg.CharsetLength = length
+		}
+	}
+	if envStreamLimit := os.Getenv("STREAM_MAX_ITEMS"); envStreamLimit != "" {
+		if limit, err := strconv.Atoi(envStreamLimit); err == nil {
+			cfg.FlagStreamLimit = limit
+		}
+	}
+	if envDedupScope := os.Getenv("DEDUP_SCOPE"); envDedupScope != "" {
+		cfg.FlagDedupScope = envDedupScope
+	}
+	if envBlocklistDomains := os.Getenv("BLOCKLIST_DOMAINS"); envBlocklistDomains != "" {
+		cfg.FlagBlocklistDomains = envBlocklistDomains
+	}
+	if envBlocklistPatterns := os.Getenv("BLOCKLIST_PATTERNS"); envBlocklistPatterns != "" {
+		cfg.FlagBlocklistPatterns = envBlocklistPatterns
+	}
+	if envBlocklistHashes := os.Getenv("BLOCKLIST_HASHES"); envBlocklistHashes != "" {
+		cfg.FlagBlocklistHashes = envBlocklistHashes
+	}
+	if envBlocklistReload := os.Getenv("BLOCKLIST_RELOAD"); envBlocklistReload != "" {
+		if interval, err := time.ParseDuration(envBlocklistReload); err == nil {
+			cfg.FlagBlocklistReload = interval
+		}
+	}
+	if envAllowedSchemes := os.Getenv("ALLOWED_SCHEMES"); envAllowedSchemes != "" {
+		cfg.FlagAllowedSchemes = envAllowedSchemes
+	}
+	if envMaxURLLength := os.Getenv("MAX_URL_LENGTH"); envMaxURLLength != "" {
+		if length, err := strconv.Atoi(envMaxURLLength); err == nil {
+			cfg.FlagMaxURLLength = length
+		}
+	}
+	if envAllowedHosts := os.Getenv("ALLOWED_HOSTS"); envAllowedHosts != "" {
+		cfg.FlagAllowedHosts = envAllowedHosts
+	}
+	if envBlockPrivate := os.Getenv("BLOCK_PRIVATE"); envBlockPrivate != "" {
+		if block, err := strconv.ParseBool(envBlockPrivate); err == nil {
+			cfg.FlagBlockPrivate = block
+		}
+	}
+	if envResolveDNS := os.Getenv("RESOLVE_DNS"); envResolveDNS != "" {
+		if resolve, err := strconv.ParseBool(envResolveDNS); err == nil {
+			cfg.FlagResolveDNS = resolve
+		}
+	}
+	if envShortenerDomains := os.Getenv("SHORTENER_DOMAINS"); envShortenerDomains != "" {
+		cfg.FlagShortenerDomains = envShortenerDomains
+	}
+	if envShortenerPolicy := os.Getenv("SHORTENER_POLICY"); envShortenerPolicy != "" {
+		cfg.FlagShortenerPolicy = envShortenerPolicy
+	}
+	if envResolveMaxHops := os.Getenv("RESOLVE_MAX_HOPS"); envResolveMaxHops != "" {
+		if hops, err := strconv.Atoi(envResolveMaxHops); err == nil {
+			cfg.FlagResolveMaxHops = hops
+		}
+	}
+	if envResolveTimeout := os.Getenv("RESOLVE_TIMEOUT"); envResolveTimeout != "" {
+		if timeout, err := time.ParseDuration(envResolveTimeout); err == nil {
+			cfg.FlagResolveTimeout = timeout
+		}
+	}
+	if envPasswordAttempts := os.Getenv("PASSWORD_ATTEMPTS"); envPasswordAttempts != "" {
+		if attempts, err := strconv.Atoi(envPasswordAttempts); err == nil {
+			cfg.FlagPasswordAttempts = attempts
+		}
+	}
+	if envPasswordWindow := os.Getenv("PASSWORD_WINDOW"); envPasswordWindow != "" {
+		if window, err := time.ParseDuration(envPasswordWindow); err == nil {
+			cfg.FlagPasswordWindow = window
+		}
+	}
+	if envCanonicalRules := os.Getenv("CANONICAL_RULES"); envCanonicalRules != "" {
+		cfg.FlagCanonicalRules = envCanonicalRules
+	}
+	if envTrackingParams := os.Getenv("TRACKING_PARAMS"); envTrackingParams != "" {
+		cfg.FlagTrackingParams = envTrackingParams
+	}
+	if envAdminToken := os.Getenv("ADMIN_TOKEN"); envAdminToken != "" {
+		cfg.FlagAdminToken = envAdminToken
+	}
+	if envMaxConns := os.Getenv("DB_MAX_CONNS"); envMaxConns != "" {
+		if maxConns, err := strconv.Atoi(envMaxConns); err == nil {
+			cfg.FlagDBMaxConns = maxConns
+		}
+	}
+	if envMinConns := os.Getenv("DB_MIN_CONNS"); envMinConns != "" {
+		if minConns, err := strconv.Atoi(envMinConns); err == nil {
+			cfg.FlagDBMinConns = minConns
+		}
+	}
+	if envLifetime := os.Getenv("DB_MAX_CONN_LIFETIME"); envLifetime != "" {
+		if lifetime, err := time.ParseDuration(envLifetime); err == nil {
+			cfg.FlagDBMaxConnLifetime = lifetime
+		}
+	}
+	if envIdleTime := os.Getenv("DB_MAX_CONN_IDLE_TIME"); envIdleTime != "" {
+		if idleTime, err := time.ParseDuration(envIdleTime); err == nil {
+			cfg.FlagDBMaxConnIdleTime = idleTime
+		}
+	}
+	if envConnectTimeout := os.Getenv("DB_CONNECT_TIMEOUT"); envConnectTimeout != "" {
+		if timeout, err := time.ParseDuration(envConnectTimeout); err == nil {
+			cfg.FlagDBConnectTimeout = timeout
+		}
+	}
+	if cfg.FlagReapInterval <= 0 {
+		cfg.FlagReapInterval = time.Minute
+	}
 
 	// Убеждаемся, что BaseURL всегда заканчивается на "/"
 	if !strings.HasSuffix(cfg.FlagBaseURL, "/") {
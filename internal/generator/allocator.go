@@ -0,0 +1,45 @@
+package generator
+
+import (
+	"context"
+	"sync"
+)
+
+// BlockSource выдаёт номера блоков (hi) из общего для всех экземпляров сервиса источника
+type BlockSource interface {
+	NextIDBlock(ctx context.Context) (uint64, error)
+}
+
+// BlockAllocator — hi/lo-распределитель: берёт у источника номер блока hi
+// и раздаёт идентификаторы hi*size ... hi*size+size-1 без обращения к хранилищу.
+// Разные экземпляры получают разные блоки, поэтому идентификаторы не пересекаются.
+type BlockAllocator struct {
+	source BlockSource
+	size   uint64
+
+	mu   sync.Mutex
+	next uint64
+	end  uint64
+}
+
+func NewBlockAllocator(source BlockSource, size uint64) *BlockAllocator {
+	return &BlockAllocator{source: source, size: size}
+}
+
+func (a *BlockAllocator) Next(ctx context.Context) (uint64, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.next == a.end {
+		hi, err := a.source.NextIDBlock(ctx)
+		if err != nil {
+			return 0, err
+		}
+		a.next = hi * a.size
+		a.end = a.next + a.size
+	}
+
+	id := a.next
+	a.next++
+	return id, nil
+}
@@ -0,0 +1,228 @@
+package generator
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+const (
+	StrategyRandom     = "random"
+	StrategySequential = "sequential"
+	StrategyHash       = "hash"
+	StrategyPermuted   = "permuted"
+
+	// Base62 — алфавит для кодирования числовых идентификаторов
+	Base62 = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+	// MaxCounterLength — максимальная длина кода, при которой 62^length помещается в uint64
+	MaxCounterLength = 10
+
+	feistelRounds = 4
+)
+
+var (
+	ErrUnknownStrategy = errors.New("неизвестная стратегия генерации коротких ссылок")
+	ErrInvalidLength   = errors.New("недопустимая длина короткой ссылки")
+	ErrSpaceExhausted  = errors.New("исчерпано пространство коротких ссылок")
+)
+
+// Generator выдаёт короткие коды для новых ссылок.
+// attempt > 0 означает повторную попытку после коллизии.
+type Generator interface {
+	Generate(ctx context.Context, original string, attempt int) (string, error)
+}
+
+// IDSource выдаёт уникальные числовые идентификаторы для счётчиковых стратегий
+type IDSource interface {
+	Next(ctx context.Context) (uint64, error)
+}
+
+// New создаёт генератор по названию стратегии.
+// ids — источник идентификаторов для стратегий sequential и permuted.
+func New(strategy string, length int, charset string, key []byte, ids IDSource) (Generator, error) {
+	if length <= 0 {
+		return nil, ErrInvalidLength
+	}
+	switch strategy {
+	case StrategyRandom:
+		return &Random{charset: charset, length: length}, nil
+	case StrategyHash:
+		if length > MaxCounterLength {
+			return nil, ErrInvalidLength
+		}
+		return &Hash{length: length}, nil
+	case StrategySequential:
+		if length > MaxCounterLength {
+			return nil, ErrInvalidLength
+		}
+		return &Sequential{ids: ids, length: length}, nil
+	case StrategyPermuted:
+		if length > MaxCounterLength {
+			return nil, ErrInvalidLength
+		}
+		return &Permuted{ids: ids, perm: NewPermutation(space(length), key), length: length}, nil
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnknownStrategy, strategy)
+}
+
+// Random — случайный код из символов charset на основе crypto/rand
+type Random struct {
+	charset string
+	length  int
+}
+
+func (g *Random) Generate(context.Context, string, int) (string, error) {
+	var builder strings.Builder
+	builder.Grow(g.length)
+
+	max := big.NewInt(int64(len(g.charset)))
+	for i := 0; i < g.length; i++ {
+		indx, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		builder.WriteByte(g.charset[indx.Int64()])
+	}
+
+	return builder.String(), nil
+}
+
+// Sequential — порядковый номер ссылки в base62
+type Sequential struct {
+	ids    IDSource
+	length int
+}
+
+func (g *Sequential) Generate(ctx context.Context, _ string, _ int) (string, error) {
+	n, err := g.ids.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n >= space(g.length) {
+		return "", ErrSpaceExhausted
+	}
+	return Encode(n, g.length), nil
+}
+
+// Hash — детерминированный код из SHA-256 адреса, при коллизии к адресу добавляется номер попытки
+type Hash struct {
+	length int
+}
+
+func (g *Hash) Generate(_ context.Context, original string, attempt int) (string, error) {
+	input := original
+	if attempt > 0 {
+		input += "#" + strconv.Itoa(attempt)
+	}
+	sum := sha256.Sum256([]byte(input))
+	return Encode(binary.BigEndian.Uint64(sum[:8])%space(g.length), g.length), nil
+}
+
+// Permuted — порядковый номер, пропущенный через обратимую перестановку:
+// коды не идут подряд, но и не повторяются, пока не исчерпано пространство.
+type Permuted struct {
+	ids    IDSource
+	perm   *Permutation
+	length int
+}
+
+func (g *Permuted) Generate(ctx context.Context, _ string, _ int) (string, error) {
+	n, err := g.ids.Next(ctx)
+	if err != nil {
+		return "", err
+	}
+	if n >= g.perm.size {
+		return "", ErrSpaceExhausted
+	}
+	return Encode(g.perm.Apply(n), g.length), nil
+}
+
+// Encode записывает n в base62, дополняя слева нулями до length символов
+func Encode(n uint64, length int) string {
+	buf := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = Base62[n%62]
+		n /= 62
+	}
+	return string(buf)
+}
+
+func space(length int) uint64 {
+	n := uint64(1)
+	for i := 0; i < length; i++ {
+		n *= 62
+	}
+	return n
+}
+
+// Permutation — биекция на [0, size): сеть Фейстеля на ближайшей сверху
+// степени двойки с чётным числом бит и «прогулкой по циклу» до попадания в диапазон.
+type Permutation struct {
+	size     uint64
+	halfBits uint
+	key      []byte
+}
+
+func NewPermutation(size uint64, key []byte) *Permutation {
+	width := uint(bits.Len64(size - 1))
+	if width%2 == 1 {
+		width++
+	}
+	if width == 0 {
+		width = 2
+	}
+	return &Permutation{size: size, halfBits: width / 2, key: key}
+}
+
+// Apply возвращает образ n; n должен быть меньше size
+func (p *Permutation) Apply(n uint64) uint64 {
+	for {
+		n = p.feistel(n, false)
+		if n < p.size {
+			return n
+		}
+	}
+}
+
+// Invert возвращает прообраз n
+func (p *Permutation) Invert(n uint64) uint64 {
+	for {
+		n = p.feistel(n, true)
+		if n < p.size {
+			return n
+		}
+	}
+}
+
+func (p *Permutation) feistel(n uint64, inverse bool) uint64 {
+	mask := uint64(1)<<p.halfBits - 1
+	left, right := n>>p.halfBits&mask, n&mask
+	for i := 0; i < feistelRounds; i++ {
+		round := i
+		if inverse {
+			round = feistelRounds - 1 - i
+			left, right = right^p.round(round, left)&mask, left
+			continue
+		}
+		left, right = right, left^p.round(round, right)&mask
+	}
+	return left<<p.halfBits | right
+}
+
+func (p *Permutation) round(round int, value uint64) uint64 {
+	mac := hmac.New(sha256.New, p.key)
+	var buf [9]byte
+	buf[0] = byte(round)
+	binary.BigEndian.PutUint64(buf[1:], value)
+	mac.Write(buf[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
@@ -0,0 +1,104 @@
+package generator
+
+import (
+	"context"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPermutationIsBijection(t *testing.T) {
+	for _, size := range []uint64{1, 62, 62 * 62, 1000} {
+		perm := NewPermutation(size, []byte("key"))
+		seen := make(map[uint64]bool, size)
+		for n := uint64(0); n < size; n++ {
+			image := perm.Apply(n)
+			assert.Less(t, image, size)
+			assert.False(t, seen[image], "duplicate image %d for size %d", image, size)
+			seen[image] = true
+			assert.Equal(t, n, perm.Invert(image))
+		}
+	}
+}
+
+func TestGenerators(t *testing.T) {
+	tests := []struct {
+		strategy string
+		unique   bool
+	}{
+		{StrategyRandom, false},
+		{StrategySequential, true},
+		{StrategyHash, false},
+		{StrategyPermuted, true},
+	}
+
+	pattern := regexp.MustCompile(`^[a-zA-Z0-9]{7}$`)
+	for _, tt := range tests {
+		t.Run(tt.strategy, func(t *testing.T) {
+			g, err := New(tt.strategy, 7, Base62, []byte("key"), NewBlockAllocator(&blocks{}, 100))
+			require.NoError(t, err)
+
+			seen := map[string]bool{}
+			for i := 0; i < 1000; i++ {
+				code, err := g.Generate(context.Background(), "https://example.com", i)
+				require.NoError(t, err)
+				assert.Regexp(t, pattern, code)
+				if tt.unique {
+					assert.False(t, seen[code])
+				}
+				seen[code] = true
+			}
+		})
+	}
+
+	t.Run("hash is deterministic", func(t *testing.T) {
+		g, err := New(StrategyHash, 7, Base62, nil, nil)
+		require.NoError(t, err)
+		first, _ := g.Generate(context.Background(), "https://example.com", 0)
+		second, _ := g.Generate(context.Background(), "https://example.com", 0)
+		retry, _ := g.Generate(context.Background(), "https://example.com", 1)
+		assert.Equal(t, first, second)
+		assert.NotEqual(t, first, retry)
+	})
+
+	t.Run("sequential takes ids from blocks", func(t *testing.T) {
+		g, err := New(StrategySequential, 3, Base62, nil, NewBlockAllocator(&blocks{next: 1}, 62))
+		require.NoError(t, err)
+		code, _ := g.Generate(context.Background(), "", 0)
+		assert.Equal(t, "010", code)
+	})
+
+	t.Run("unknown strategy", func(t *testing.T) {
+		_, err := New("dice", 7, Base62, nil, nil)
+		assert.ErrorIs(t, err, ErrUnknownStrategy)
+	})
+}
+
+type blocks struct {
+	next uint64
+}
+
+func (b *blocks) NextIDBlock(context.Context) (uint64, error) {
+	hi := b.next
+	b.next++
+	return hi, nil
+}
+
+func TestBlockAllocator(t *testing.T) {
+	source := &blocks{}
+	first := NewBlockAllocator(source, 10)
+	second := NewBlockAllocator(source, 10)
+
+	seen := map[uint64]bool{}
+	for i := 0; i < 25; i++ {
+		for _, allocator := range []*BlockAllocator{first, second} {
+			id, err := allocator.Next(context.Background())
+			require.NoError(t, err)
+			assert.False(t, seen[id], "id %d allocated twice", id)
+			seen[id] = true
+		}
+	}
+	assert.Equal(t, uint64(6), source.next)
+}
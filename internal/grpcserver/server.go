@@ -0,0 +1,251 @@
+package grpcserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/api/pb"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/analytics"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtauth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type userKey struct{}
+
+// Server реализует gRPC API поверх того же хранилища и логики, что и HTTP-хендлеры
+type Server struct {
+	pb.UnimplementedShortenerServer
+	cfg *config.Config
+}
+
+// New создаёт gRPC-сервер с проверкой JWT из метаданных
+func New(cfg *config.Config) *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(AuthInterceptor(cfg)))
+	pb.RegisterShortenerServer(server, &Server{cfg: cfg})
+	return server
+}
+
+// AuthInterceptor достаёт пользователя из "authorization: Bearer <token>".
+// Без токена заводится новый пользователь, а его токен возвращается в заголовке ответа.
+func AuthInterceptor(cfg *config.Config) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		var token string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get("authorization"); len(values) > 0 {
+				token = strings.TrimPrefix(values[0], "Bearer ")
+			}
+		}
+
+		if token == "" {
+			var err error
+			token, err = shortener.RegisterUser(ctx, cfg)
+			if err != nil {
+				cfg.Sugar.Error(err)
+				return nil, status.Error(codes.Internal, "Ошибка сервера")
+			}
+			if err := grpc.SetHeader(ctx, metadata.Pairs("authorization", "Bearer "+token)); err != nil {
+				return nil, status.Error(codes.Internal, "Ошибка сервера")
+			}
+		}
+
+		claims, err := jwtauth.ParseJWTString(token)
+		if err != nil {
+			return nil, status.Error(codes.Unauthenticated, "Недействительный токен")
+		}
+
+		return handler(context.WithValue(ctx, userKey{}, claims), req)
+	}
+}
+
+func userFromContext(ctx context.Context) (*jwtauth.Claims, error) {
+	claims, ok := ctx.Value(userKey{}).(*jwtauth.Claims)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "You are not authorized")
+	}
+	return claims, nil
+}
+
+func (s *Server) Shorten(ctx context.Context, req *pb.ShortenRequest) (*pb.ShortenResponse, error) {
+	claims, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	parsedURL, err := url.ParseRequestURI(req.GetUrl())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid URL")
+	}
+	expiresAt, err := shortener.ResolveExpiry(timestamp(req.GetExpiresAt()), int(req.GetTtlSeconds()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, "Invalid expires_at or ttl_seconds")
+	}
+
+	uuid := storage.NewCorrelationID()
+	var link string
+	if req.GetAlias() != "" {
+		link, err = shortener.AddAlias(ctx, s.cfg, parsedURL.String(), req.GetAlias(), uuid, claims.UserID, expiresAt, "")
+	} else {
+		link, err = shortener.AddLink(ctx, s.cfg, parsedURL.String(), uuid, claims.UserID, expiresAt, "")
+	}
+	if errors.Is(err, storage.ErrURLAlreadyExists) {
+		return &pb.ShortenResponse{Result: link, AlreadyExists: true}, nil
+	}
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &pb.ShortenResponse{Result: link}, nil
+}
+
+func (s *Server) ShortenBatch(ctx context.Context, req *pb.ShortenBatchRequest) (*pb.ShortenBatchResponse, error) {
+	claims, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	links := make([]storage.InfoAboutURL, 0, len(req.GetItems()))
+	for _, item := range req.GetItems() {
+		links = append(links, storage.InfoAboutURL{
+			CorrelationID: item.GetCorrelationId(),
+			OriginalURL:   item.GetOriginalUrl(),
+			ExpiresAt:     timestamp(item.GetExpiresAt()),
+			TTLSeconds:    int(item.GetTtlSeconds()),
+			Alias:         item.GetAlias(),
+		})
+	}
+
+	results, err := shortener.AddBatch(ctx, s.cfg, links, claims.UserID)
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+
+	response := &pb.ShortenBatchResponse{}
+	for _, result := range results {
+		item := &pb.BatchResult{CorrelationId: result.CorrelationID, Status: string(result.Status)}
+		if result.Status == storage.BatchCreated || result.Status == storage.BatchExists {
+			item.ShortUrl = s.cfg.FlagBaseURL + result.ShortURL
+		}
+		if result.Err != nil {
+			item.Error = status.Convert(s.toStatus(result.Err)).Message()
+		}
+		response.Items = append(response.Items, item)
+	}
+	return response, nil
+}
+
+// Resolve не раскрывает адрес ссылки с паролем: пароль вводится только в форме при переходе.
+// Раскрытие считается переходом по ссылке и попадает в статистику, как HTTP-редирект.
+func (s *Server) Resolve(ctx context.Context, req *pb.ResolveRequest) (*pb.ResolveResponse, error) {
+	short := strings.TrimPrefix(req.GetShortCode(), s.cfg.FlagBaseURL)
+	link, err := shortener.ResolveLink(ctx, s.cfg, short)
+	switch {
+	case errors.Is(err, storage.ErrURLDeleted), errors.Is(err, storage.ErrURLExpired):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, storage.ErrURLNotFound):
+		return nil, status.Error(codes.NotFound, "URL not found")
+	case err != nil:
+		return nil, s.toStatus(err)
+	case link.PasswordHash != "":
+		return nil, status.Error(codes.PermissionDenied, "password_protected")
+	}
+	s.recordClick(ctx, short)
+	return &pb.ResolveResponse{OriginalUrl: link.OriginalURL}, nil
+}
+
+// recordClick записывает переход: Referer и User-Agent берутся из метаданных запроса, IP — из адреса клиента
+func (s *Server) recordClick(ctx context.Context, short string) {
+	click := storage.Click{ShortURL: short, Time: time.Now()}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if referrer := md.Get("referer"); len(referrer) > 0 {
+			click.Referrer = referrer[0]
+		}
+		if userAgent := md.Get("user-agent"); len(userAgent) > 0 {
+			click.UserAgent = userAgent[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip := p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		click.IPHash = analytics.HashIP(ip)
+	}
+	s.cfg.Recorder.Record(click)
+}
+
+func (s *Server) ListUserURLs(ctx context.Context, _ *pb.ListUserURLsRequest) (*pb.ListUserURLsResponse, error) {
+	claims, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.cfg.Store.GetLinksByUserID(ctx, claims.UserID)
+	if err != nil && !errors.Is(err, storage.ErrUserNotFound) {
+		return nil, s.toStatus(err)
+	}
+
+	response := &pb.ListUserURLsResponse{}
+	for key, value := range result {
+		response.Urls = append(response.Urls, &pb.UserURL{ShortUrl: s.cfg.FlagBaseURL + key, OriginalUrl: value})
+	}
+	return response, nil
+}
+
+func (s *Server) DeleteUserURLs(ctx context.Context, req *pb.DeleteUserURLsRequest) (*pb.DeleteUserURLsResponse, error) {
+	claims, err := userFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	shortURLs := make([]string, 0, len(req.GetShortCodes()))
+	for _, code := range req.GetShortCodes() {
+		shortURLs = append(shortURLs, strings.TrimPrefix(code, s.cfg.FlagBaseURL))
+	}
+	if err := s.cfg.Deleter.Enqueue(ctx, claims.UserID, shortURLs); err != nil {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return &pb.DeleteUserURLsResponse{}, nil
+}
+
+// toStatus переводит ошибки сервиса в коды gRPC так же, как HTTP-хендлеры — в HTTP-статусы
+func (s *Server) toStatus(err error) error {
+	switch {
+	case errors.Is(err, shortener.ErrInvalidAlias),
+		errors.Is(err, shortener.ErrReservedAlias),
+		errors.Is(err, shortener.ErrInvalidExpiry),
+		errors.Is(err, shortener.ErrInvalidPassword),
+		errors.Is(err, shortener.ErrInvalidBatchItem):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrShortURLTaken):
+		return status.Error(codes.AlreadyExists, "alias_taken")
+	case errors.Is(err, vetting.ErrBlocked):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if code, ok := policy.Code(err); ok {
+		return status.Error(codes.InvalidArgument, code)
+	}
+	s.cfg.Sugar.Error(err)
+	return status.Error(codes.Internal, "Problem service")
+}
+
+func timestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
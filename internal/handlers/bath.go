@@ -1,28 +1,30 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"strings"
 
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
 	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 
 	"github.com/gin-gonic/gin"
 )
 
-type infoAboutURL struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
-	ShortLink     string
-}
-
 type infoAboutURLResponse struct {
-	CorrelationID string `json:"correlation_id"`
-	ShortLink     string `json:"short_url"`
+	CorrelationID string              `json:"correlation_id"`
+	ShortLink     string              `json:"short_url,omitempty"`
+	Status        storage.BatchStatus `json:"status"`
+	Error         string              `json:"error,omitempty"`
+	Reason        string              `json:"reason,omitempty"`
 }
 
+// Batch сокращает пакет ссылок. Каждая ссылка получает свой статус; если исходы
+// различаются, ответ — 207 Multi-Status, иначе код соответствует общему исходу.
 func Batch(c *gin.Context, cfg *config.Config) {
 	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json"})
@@ -34,6 +36,10 @@ func Batch(c *gin.Context, cfg *config.Config) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
 		return
 	}
+	if len(links) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Empty batch"})
+		return
+	}
 
 	ctx := c.Request.Context()
 	claims, exist := c.Get("user")
@@ -43,26 +49,90 @@ func Batch(c *gin.Context, cfg *config.Config) {
 	}
 	userClaims := claims.(*jwtAuth.Claims)
 
-	for i, link := range links {
-		if link.OriginalURL == "" || link.CorrelationID == "" {
-			c.JSON(http.StatusBadRequest, "JSON is not correctly")
-			return
+	results, err := shortener.AddBatch(ctx, cfg, links, userClaims.UserID)
+	if err != nil {
+		// Хранилище не обработало пакет целиком — ни одна ссылка не сохранена
+		cfg.Sugar.Error(err)
+		results = make([]storage.BatchResult, len(links))
+		for i, link := range links {
+			results[i] = storage.BatchResult{CorrelationID: link.CorrelationID, Status: storage.BatchError, Err: err}
 		}
-		links[i].ShortLink = shortener.GenerateLink(cfg)
 	}
 
-	_, err := cfg.Store.AddLinksBatch(ctx, links, userClaims.UserID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, "Problem service")
-		return
+	response := make([]infoAboutURLResponse, 0, len(results))
+	for _, result := range results {
+		item := infoAboutURLResponse{CorrelationID: result.CorrelationID, Status: result.Status}
+		if result.ShortURL != "" && (result.Status == storage.BatchCreated || result.Status == storage.BatchExists) {
+			item.ShortLink = cfg.FlagBaseURL + result.ShortURL
+		}
+		if result.Err != nil {
+			item.Error, item.Reason = batchItemError(cfg, result), blockReason(result.Err)
+		}
+		response = append(response, item)
+	}
+
+	c.JSON(batchStatusCode(results), response)
+}
+
+// batchStatusCode выбирает код ответа по набору исходов ссылок пакета.
+// Пакет, где все ссылки упёрлись в занятый алиас или correlation_id, — конфликт, а не сбой сервера.
+func batchStatusCode(results []storage.BatchResult) int {
+	statuses := map[storage.BatchStatus]bool{}
+	conflict := true
+	for _, result := range results {
+		statuses[result.Status] = true
+		if result.Status == storage.BatchError && !isBatchConflict(result.Err) {
+			conflict = false
+		}
+	}
+	if len(statuses) > 1 {
+		return http.StatusMultiStatus
 	}
-	var response []infoAboutURLResponse
-	for _, link := range links {
-		response = append(response, infoAboutURLResponse{
-			CorrelationID: link.CorrelationID,
-			ShortLink:     cfg.FlagBaseURL + link.ShortLink,
-		})
+	switch {
+	case statuses[storage.BatchExists]:
+		return http.StatusConflict
+	case statuses[storage.BatchInvalid]:
+		return http.StatusBadRequest
+	case statuses[storage.BatchBlocked]:
+		return http.StatusUnprocessableEntity
+	case statuses[storage.BatchError] && conflict:
+		return http.StatusConflict
+	case statuses[storage.BatchError]:
+		return http.StatusInternalServerError
 	}
+	return http.StatusCreated
+}
+
+func isBatchConflict(err error) bool {
+	return errors.Is(err, storage.ErrShortURLTaken) || errors.Is(err, storage.ErrUUIDTaken)
+}
 
-	c.JSON(http.StatusCreated, response)
+// batchItemError переводит ошибку ссылки пакета в код для клиента
+func batchItemError(cfg *config.Config, result storage.BatchResult) string {
+	err := result.Err
+	if code, ok := policy.Code(err); ok {
+		return code
+	}
+	switch {
+	case errors.Is(err, shortener.ErrInvalidBatchItem):
+		return "missing_field"
+	case errors.Is(err, vetting.ErrBlocked):
+		return "blocked_url"
+	case errors.Is(err, shortener.ErrInvalidURL):
+		return "invalid_url"
+	case errors.Is(err, shortener.ErrInvalidExpiry):
+		return "invalid_expiry"
+	case errors.Is(err, shortener.ErrInvalidPassword):
+		return "invalid_password"
+	case errors.Is(err, shortener.ErrInvalidAlias):
+		return "invalid_alias"
+	case errors.Is(err, shortener.ErrReservedAlias):
+		return "reserved_alias"
+	case errors.Is(err, storage.ErrShortURLTaken):
+		return "alias_taken"
+	case errors.Is(err, storage.ErrUUIDTaken):
+		return "correlation_id_taken"
+	}
+	cfg.Sugar.Errorf("batch item %s: %v", result.CorrelationID, err)
+	return "internal_error"
 }
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeleteUserURLs принимает список коротких ссылок и удаляет их асинхронно
+func DeleteUserURLs(c *gin.Context, cfg *config.Config) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json"})
+		return
+	}
+
+	var shortURLs []string
+	if err := c.ShouldBindJSON(&shortURLs); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	claims, exist := c.Get("user")
+	if !exist {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You are not authorized"})
+		return
+	}
+	userClaims, ok := claims.(*jwtAuth.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		return
+	}
+
+	if err := cfg.Deleter.Enqueue(c.Request.Context(), userClaims.UserID, shortURLs); err != nil {
+		cfg.Sugar.Error("Ошибка постановки удаления в очередь:", err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Deletion queue is unavailable"})
+		return
+	}
+	c.Status(http.StatusAccepted)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxExpandItems ограничивает число кодов в одном запросе /api/expand/batch
+const maxExpandItems = 1000
+
+// Статусы ссылок в ответе /api/expand/batch
+const (
+	expandActive   = "active"
+	expandBlocked  = "blocked"
+	expandDeleted  = "deleted"
+	expandExpired  = "expired"
+	expandNotFound = "not_found"
+	expandInvalid  = "invalid"
+)
+
+type expandResponse struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url,omitempty"`
+	Status      string     `json:"status"`
+	Owner       bool       `json:"owner"`
+	Protected   bool       `json:"protected,omitempty"`
+	Title       string     `json:"title,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// ExpandBatch раскрывает пачку коротких кодов или полных коротких ссылок в исходные адреса.
+// Адрес удалённой, истёкшей, заблокированной или защищённой паролем ссылки, её заголовок и срок действия видит только владелец.
+func ExpandBatch(c *gin.Context, cfg *config.Config) {
+	var keys []string
+	if err := c.ShouldBindJSON(&keys); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+	if len(keys) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Empty batch"})
+		return
+	}
+	if len(keys) > maxExpandItems {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_items"})
+		return
+	}
+
+	claims, exist := c.Get("user")
+	if !exist {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You are not authorized"})
+		return
+	}
+	userClaims := claims.(*jwtAuth.Claims)
+
+	shorts := make([]string, len(keys))
+	for i, key := range keys {
+		shorts[i] = strings.TrimPrefix(key, cfg.FlagBaseURL)
+	}
+
+	ctx := c.Request.Context()
+	links, err := cfg.Store.GetLinks(ctx, shorts)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return
+	}
+
+	now := time.Now()
+	response := make([]expandResponse, len(keys))
+	for i, short := range shorts {
+		item := expandResponse{ShortURL: cfg.FlagBaseURL + short, Status: expandNotFound}
+		link, found := links[short]
+		switch {
+		case short == "" || strings.Contains(short, "/"):
+			item.ShortURL, item.Status = keys[i], expandInvalid
+		case !found:
+		case link.Deleted:
+			item.Status = expandDeleted
+		case link.ExpiresAt != nil && !link.ExpiresAt.After(now):
+			item.Status = expandExpired
+		case errors.Is(shortener.Vet(ctx, cfg, link.OriginalURL), vetting.ErrBlocked):
+			item.Status = expandBlocked
+		default:
+			item.Status = expandActive
+			if link.PasswordHash == "" {
+				item.OriginalURL = link.OriginalURL
+			}
+		}
+		item.Protected = found && link.PasswordHash != ""
+		if found && link.UserID == userClaims.UserID {
+			item.Owner = true
+			item.OriginalURL, item.Title, item.ExpiresAt = link.OriginalURL, link.Title, link.ExpiresAt
+		}
+		response[i] = item
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -17,8 +17,17 @@ func SetupRoutes(router *gin.Engine, cfg *config.Config) {
 	// Передаем cfg в обработчики
 	router.POST("/", func(c *gin.Context) { AddAddress(c, cfg) })
 	router.GET("/:key", func(c *gin.Context) { GetAddress(c, cfg) })
+	router.POST("/:key", func(c *gin.Context) { UnlockAddress(c, cfg) })
 	router.POST("/api/shorten", func(c *gin.Context) { AddAddressJSON(c, cfg) })
 	router.GET("/ping", func(c *gin.Context) { StatusConnDB(c, cfg) })
 	router.POST("/api/shorten/batch", func(c *gin.Context) { Batch(c, cfg) })
+	router.POST("/api/shorten/stream", func(c *gin.Context) { Stream(c, cfg) })
+	router.POST("/api/expand/batch", func(c *gin.Context) { ExpandBatch(c, cfg) })
+	router.GET("/api/lookup", func(c *gin.Context) { Lookup(c, cfg) })
 	router.GET("/api/user/urls", func(c *gin.Context) { GetAddressFromUser(c, cfg) })
+	router.DELETE("/api/user/urls", func(c *gin.Context) { DeleteUserURLs(c, cfg) })
+	router.PATCH("/api/user/urls/:key", func(c *gin.Context) { UpdateUserURL(c, cfg) })
+	router.GET("/api/user/urls/:key/stats", func(c *gin.Context) { GetLinkStats(c, cfg) })
+	router.GET("/api/user/urls/:key/history", func(c *gin.Context) { GetURLHistory(c, cfg) })
+	router.POST("/api/user/urls/:key/rollback", func(c *gin.Context) { RollbackURL(c, cfg) })
 }
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetURLHistory отдаёт владельцу историю смены адреса назначения ссылки
+func GetURLHistory(c *gin.Context, cfg *config.Config) {
+	key, _, ok := requireOwner(c, cfg)
+	if !ok {
+		return
+	}
+
+	history, err := cfg.Store.GetHistory(c.Request.Context(), key)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// RollbackURL отменяет изменение с номером version и все последующие:
+// ссылка снова ведёт туда, куда вела до этой версии.
+func RollbackURL(c *gin.Context, cfg *config.Config) {
+	version, err := strconv.Atoi(c.Query("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version must be a positive integer"})
+		return
+	}
+
+	key, userID, ok := requireOwner(c, cfg)
+	if !ok {
+		return
+	}
+
+	history, err := cfg.Store.GetHistory(c.Request.Context(), key)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return
+	}
+
+	for _, entry := range history {
+		if entry.Version == version {
+			applyUpdate(c, cfg, key, userID, storage.LinkUpdate{OriginalURL: &entry.OldURL})
+			return
+		}
+	}
+
+	c.JSON(http.StatusNotFound, gin.H{"error": "Version not found"})
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+
+	"github.com/gin-gonic/gin"
+)
+
+type lookupResponse struct {
+	ShortURL  string     `json:"short_url"`
+	Title     string     `json:"title,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    int        `json:"user_id,omitempty"`
+}
+
+// Lookup находит действующие короткие ссылки на адрес из параметра url, адрес сравнивается в канонической форме.
+// Обычный пользователь видит только свои ссылки, с административным токеном — ссылки всех пользователей.
+func Lookup(c *gin.Context, cfg *config.Config) {
+	original, _, err := shortener.Canonicalize(cfg, c.Query("url"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL"})
+		return
+	}
+
+	claims, exist := c.Get("user")
+	if !exist {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You are not authorized"})
+		return
+	}
+	userClaims := claims.(*jwtAuth.Claims)
+	admin := isAdmin(c, cfg)
+
+	links, err := cfg.Store.GetLinksByOriginal(c.Request.Context(), original)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return
+	}
+
+	now := time.Now()
+	response := make([]lookupResponse, 0, len(links))
+	for _, link := range links {
+		if link.Deleted || (link.ExpiresAt != nil && !link.ExpiresAt.After(now)) {
+			continue
+		}
+		if !admin && link.UserID != userClaims.UserID {
+			continue
+		}
+		item := lookupResponse{ShortURL: cfg.FlagBaseURL + link.ShortURL, Title: link.Title, ExpiresAt: link.ExpiresAt}
+		if admin {
+			item.UserID = link.UserID
+		}
+		response = append(response, item)
+	}
+	if len(response) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
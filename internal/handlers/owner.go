@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requireOwner проверяет, что ссылка из пути запроса принадлежит текущему пользователю.
+// При ошибке ответ клиенту уже отправлен и возвращается ok == false.
+func requireOwner(c *gin.Context, cfg *config.Config) (key string, userID int, ok bool) {
+	claims, exist := c.Get("user")
+	if !exist {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You are not authorized"})
+		return "", 0, false
+	}
+	userClaims, ok := claims.(*jwtAuth.Claims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token data"})
+		return "", 0, false
+	}
+
+	key = c.Param("key")
+	owner, err := cfg.Store.GetLinkOwner(c.Request.Context(), key)
+	if err != nil {
+		if errors.Is(err, storage.ErrURLNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+			return "", 0, false
+		}
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return "", 0, false
+	}
+	if owner != userClaims.UserID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "URL belongs to another user"})
+		return "", 0, false
+	}
+	return key, userClaims.UserID, true
+}
+
+// isAdmin сообщает, что запрос пришёл с административным токеном из X-Admin-Token
+func isAdmin(c *gin.Context, cfg *config.Config) bool {
+	token := c.GetHeader("X-Admin-Token")
+	return cfg.FlagAdminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(cfg.FlagAdminToken)) == 1
+}
@@ -2,12 +2,16 @@ package handlers
 
 import (
 	"errors"
+	"html/template"
 	"net/http"
+	"time"
 
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/analytics"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
 	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 
 	"github.com/gin-gonic/gin"
 )
@@ -19,12 +23,117 @@ type userURL struct {
 
 func GetAddress(c *gin.Context, cfg *config.Config) {
 	path := c.Param("key")
-	ctx := c.Request.Context()
-	link, found := shortener.GetLink(ctx, cfg, path)
-	if found {
-		c.Redirect(http.StatusTemporaryRedirect, link)
-	} else {
+	link, ok := resolveLink(c, cfg, path)
+	if !ok {
+		return
+	}
+	if link.PasswordHash != "" {
+		// Пароль уже введён недавно — форму не показываем
+		token, err := c.Cookie(linkAccessCookie)
+		if err != nil || jwtAuth.CheckLinkAccess(token, path, link.PasswordHash) != nil {
+			renderPasswordForm(c, http.StatusOK, path, "")
+			return
+		}
+	}
+	recordClick(c, cfg, path)
+	c.Redirect(http.StatusTemporaryRedirect, link.OriginalURL)
+}
+
+// UnlockAddress проверяет пароль из формы ссылки, запоминает доступ в cookie и перенаправляет на адрес ссылки
+func UnlockAddress(c *gin.Context, cfg *config.Config) {
+	path := c.Param("key")
+	link, ok := resolveLink(c, cfg, path)
+	if !ok {
+		return
+	}
+	if link.PasswordHash != "" {
+		err := shortener.UnlockLink(cfg, link, c.PostForm("password"))
+		switch {
+		case errors.Is(err, shortener.ErrTooManyAttempts):
+			renderPasswordForm(c, http.StatusTooManyRequests, path, "Слишком много попыток, повторите позже")
+			return
+		case err != nil:
+			renderPasswordForm(c, http.StatusUnauthorized, path, "Неверный пароль")
+			return
+		}
+		token, err := jwtAuth.BuildLinkAccessString(path, link.PasswordHash)
+		if err != nil {
+			cfg.Sugar.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+			return
+		}
+		http.SetCookie(c.Writer, &http.Cookie{
+			Name:     linkAccessCookie,
+			Value:    token,
+			Path:     "/" + path,
+			MaxAge:   int(jwtAuth.LinkAccessEXP.Seconds()),
+			Secure:   c.Request.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+	recordClick(c, cfg, path)
+	// 303: браузер переходит по адресу GET-запросом, а не повторяет отправку формы
+	c.Redirect(http.StatusSeeOther, link.OriginalURL)
+}
+
+// resolveLink находит действующую ссылку, иначе отвечает клиенту сам
+func resolveLink(c *gin.Context, cfg *config.Config, path string) (*storage.LinkInfo, bool) {
+	link, err := shortener.ResolveLink(c.Request.Context(), cfg, path)
+	switch {
+	case errors.Is(err, storage.ErrURLDeleted) || errors.Is(err, storage.ErrURLExpired):
+		c.Status(http.StatusGone)
+		return nil, false
+	case errors.Is(err, storage.ErrURLNotFound):
 		c.JSON(http.StatusNotFound, nil)
+		return nil, false
+	case errors.Is(err, vetting.ErrBlocked):
+		c.JSON(http.StatusForbidden, gin.H{"error": "blocked_url"})
+		return nil, false
+	case err != nil:
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return nil, false
+	}
+	return link, true
+}
+
+func recordClick(c *gin.Context, cfg *config.Config, path string) {
+	cfg.Recorder.Record(storage.Click{
+		ShortURL:  path,
+		Time:      time.Now(),
+		Referrer:  c.Request.Referer(),
+		UserAgent: c.Request.UserAgent(),
+		IPHash:    analytics.HashIP(c.ClientIP()),
+	})
+}
+
+// linkAccessCookie хранит доступ к ссылке с паролем, путь cookie ограничен этой ссылкой
+const linkAccessCookie = "link_access"
+
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head><meta charset="utf-8"><title>Ссылка защищена паролем</title></head>
+<body>
+<form method="post" action="/{{.Key}}">
+<p>Чтобы перейти по ссылке, введите пароль.</p>
+{{if .Error}}<p role="alert">{{.Error}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Перейти</button>
+</form>
+</body>
+</html>
+`))
+
+// renderPasswordForm показывает форму ввода пароля ссылки key
+func renderPasswordForm(c *gin.Context, status int, key string, message string) {
+	// Форму нельзя встраивать в чужие страницы и кешировать
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Cache-Control", "no-store")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := passwordForm.Execute(c.Writer, struct{ Key, Error string }{key, message}); err != nil {
+		c.Error(err)
 	}
 }
 
@@ -6,19 +6,26 @@ import (
 	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 	"strings"
+	"time"
 
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
 	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Request struct {
-	URL string `json:"url"`
+	URL        string     `json:"url"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	TTLSeconds int        `json:"ttl_seconds"`
+	Alias      string     `json:"alias"`
+	// Password, если задан, нужно ввести перед переходом по ссылке
+	Password string `json:"password"`
 }
 
 type Response struct {
@@ -48,9 +55,12 @@ func AddAddress(c *gin.Context, cfg *config.Config) {
 	userClaims := claims.(*jwtAuth.Claims)
 
 	ctx := c.Request.Context()
-	uuid := strconv.Itoa(cfg.Store.Len(ctx) + 1)
-	link, err := shortener.AddLink(ctx, cfg, parsedURL.String(), uuid, userClaims.UserID)
+	uuid := storage.NewCorrelationID()
+	link, err := shortener.AddLink(ctx, cfg, parsedURL.String(), uuid, userClaims.UserID, nil, "")
 	if err != nil {
+		if policyError(c, err) || blockedError(c, err) {
+			return
+		}
 		if errors.Is(err, storage.ErrURLAlreadyExists) {
 			c.String(http.StatusConflict, link)
 			return
@@ -80,6 +90,11 @@ func AddAddressJSON(c *gin.Context, cfg *config.Config) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL"})
 		return
 	}
+	expiresAt, err := shortener.ResolveExpiry(input.ExpiresAt, input.TTLSeconds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_at or ttl_seconds"})
+		return
+	}
 	claims, exist := c.Get("user")
 	if !exist {
 		c.JSON(http.StatusUnauthorized, "You are not autorizate")
@@ -88,10 +103,22 @@ func AddAddressJSON(c *gin.Context, cfg *config.Config) {
 
 	ctx := c.Request.Context()
 
-	uuid := strconv.Itoa(cfg.Store.Len(ctx) + 1)
+	uuid := storage.NewCorrelationID()
 
-	link, err := shortener.AddLink(ctx, cfg, parsedURL.String(), uuid, userClaims.UserID)
+	var link string
+	if input.Alias != "" {
+		link, err = shortener.AddAlias(ctx, cfg, parsedURL.String(), input.Alias, uuid, userClaims.UserID, expiresAt, input.Password)
+	} else {
+		link, err = shortener.AddLink(ctx, cfg, parsedURL.String(), uuid, userClaims.UserID, expiresAt, input.Password)
+	}
 	if err != nil {
+		if aliasError(c, err, input.Alias) || policyError(c, err) || blockedError(c, err) {
+			return
+		}
+		if errors.Is(err, shortener.ErrInvalidPassword) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_password"})
+			return
+		}
 		if errors.Is(err, storage.ErrURLAlreadyExists) {
 			_, err = json.Marshal(Response{Result: link})
 			if err != nil {
@@ -108,3 +135,54 @@ func AddAddressJSON(c *gin.Context, cfg *config.Config) {
 	}
 	c.JSON(http.StatusCreated, Response{Result: link})
 }
+
+// aliasError отвечает клиенту машиночитаемой ошибкой, если err связана с алиасом
+func aliasError(c *gin.Context, err error, alias string) bool {
+	var status int
+	var code string
+	switch {
+	case errors.Is(err, shortener.ErrInvalidAlias):
+		status, code = http.StatusBadRequest, "invalid_alias"
+	case errors.Is(err, shortener.ErrReservedAlias):
+		status, code = http.StatusBadRequest, "reserved_alias"
+	case errors.Is(err, storage.ErrShortURLTaken):
+		status, code = http.StatusConflict, "alias_taken"
+	default:
+		return false
+	}
+	if alias == "" {
+		c.JSON(status, gin.H{"error": code})
+		return true
+	}
+	c.JSON(status, gin.H{"error": code, "alias": alias})
+	return true
+}
+
+// policyError отвечает 400 с кодом нарушения, если адрес не прошёл политику развёртывания
+func policyError(c *gin.Context, err error) bool {
+	code, ok := policy.Code(err)
+	if !ok {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": code})
+	return true
+}
+
+// blockedError отвечает 422 с причиной, если адрес назначения заблокирован проверкой
+func blockedError(c *gin.Context, err error) bool {
+	var blocked *vetting.BlockedError
+	if !errors.As(err, &blocked) {
+		return false
+	}
+	c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "blocked_url", "reason": blocked.Rule, "match": blocked.Match})
+	return true
+}
+
+// blockReason возвращает правило, которым заблокирован адрес, или пустую строку
+func blockReason(err error) string {
+	var blocked *vetting.BlockedError
+	if errors.As(err, &blocked) {
+		return blocked.Rule
+	}
+	return ""
+}
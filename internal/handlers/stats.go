@@ -0,0 +1,26 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetLinkStats отдаёт статистику переходов по ссылке её владельцу
+func GetLinkStats(c *gin.Context, cfg *config.Config) {
+	key, _, ok := requireOwner(c, cfg)
+	if !ok {
+		return
+	}
+
+	stats, err := cfg.Store.GetLinkStats(c.Request.Context(), key)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
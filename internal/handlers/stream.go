@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtAuth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// streamChunkSize — сколько ссылок уходит в хранилище одним AddLinksBatch
+	streamChunkSize = 500
+	// maxStreamLineSize ограничивает одну строку NDJSON, чтобы клиент не мог занять всю память
+	maxStreamLineSize = 64 * 1024
+)
+
+type streamItemResponse struct {
+	Line int `json:"line"`
+	infoAboutURLResponse
+}
+
+type streamLine struct {
+	line int
+	link storage.InfoAboutURL
+	err  error
+}
+
+// Stream сокращает ссылки из тела в формате NDJSON — по одной JSON-ссылке на строку.
+// Ссылки сохраняются порциями по streamChunkSize, а результаты каждой порции сразу
+// отправляются клиенту тоже в NDJSON. Следующая порция читается только после отправки
+// предыдущей, поэтому медленный клиент сам притормаживает загрузку.
+// Если поток прерывается, последней строкой приходит {"error": "..."}.
+func Stream(c *gin.Context, cfg *config.Config) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/x-ndjson") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/x-ndjson"})
+		return
+	}
+
+	claims, exist := c.Get("user")
+	if !exist {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "You are not authorized"})
+		return
+	}
+	userClaims := claims.(*jwtAuth.Claims)
+
+	// В HTTP/1.1 после первой отправки ответа тело запроса может стать недоступным
+	if err := http.NewResponseController(c.Writer).EnableFullDuplex(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		cfg.Sugar.Error(err)
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Status(http.StatusOK)
+
+	ctx := c.Request.Context()
+	encoder := json.NewEncoder(c.Writer)
+	scanner := bufio.NewScanner(c.Request.Body)
+	scanner.Buffer(make([]byte, 0, 4096), maxStreamLineSize)
+
+	lineNumber, items := 0, 0
+	chunk := make([]streamLine, 0, streamChunkSize)
+	for {
+		chunk = chunk[:0]
+		var abort string
+		for len(chunk) < streamChunkSize && scanner.Scan() {
+			lineNumber++
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" {
+				continue
+			}
+			if items++; cfg.FlagStreamLimit > 0 && items > cfg.FlagStreamLimit {
+				abort = "too_many_items"
+				break
+			}
+			item := streamLine{line: lineNumber}
+			item.err = json.Unmarshal([]byte(line), &item.link)
+			chunk = append(chunk, item)
+		}
+		if abort == "" {
+			if err := scanner.Err(); errors.Is(err, bufio.ErrTooLong) {
+				abort = "line_too_long"
+			} else if err != nil {
+				cfg.Sugar.Error(err)
+				abort = "read_failed"
+			}
+		}
+
+		if len(chunk) > 0 {
+			if !writeStreamChunk(c, cfg, encoder, chunk, userClaims.UserID) && abort == "" {
+				abort = "internal_error"
+			}
+		}
+		if abort != "" {
+			if err := encoder.Encode(gin.H{"error": abort}); err != nil {
+				cfg.Sugar.Error(err)
+			}
+			c.Writer.Flush()
+			return
+		}
+		if len(chunk) < streamChunkSize || ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// writeStreamChunk сохраняет порцию ссылок и отправляет их результаты.
+// Возвращает false, если хранилище не обработало порцию и поток нужно прервать.
+func writeStreamChunk(c *gin.Context, cfg *config.Config, encoder *json.Encoder, chunk []streamLine, userID int) bool {
+	links := make([]storage.InfoAboutURL, 0, len(chunk))
+	for _, item := range chunk {
+		if item.err == nil {
+			links = append(links, item.link)
+		}
+	}
+
+	results, err := shortener.AddBatch(c.Request.Context(), cfg, links, userID)
+	if err != nil {
+		cfg.Sugar.Error(err)
+		results = make([]storage.BatchResult, len(links))
+		for i, link := range links {
+			results[i] = storage.BatchResult{CorrelationID: link.CorrelationID, Status: storage.BatchError, Err: err}
+		}
+	}
+
+	for _, item := range chunk {
+		response := streamItemResponse{Line: item.line}
+		if item.err != nil {
+			response.Status, response.Error = storage.BatchInvalid, "invalid_json"
+		} else {
+			result := results[0]
+			results = results[1:]
+			response.CorrelationID, response.Status = result.CorrelationID, result.Status
+			if result.ShortURL != "" && (result.Status == storage.BatchCreated || result.Status == storage.BatchExists) {
+				response.ShortLink = cfg.FlagBaseURL + result.ShortURL
+			}
+			if result.Err != nil {
+				response.Error, response.Reason = batchItemError(cfg, result), blockReason(result.Err)
+			}
+		}
+		if err := encoder.Encode(response); err != nil {
+			// Клиент отключился — дальше читать незачем
+			cfg.Sugar.Error(err)
+			return false
+		}
+	}
+	c.Writer.Flush()
+	return err == nil
+}
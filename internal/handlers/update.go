@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+type updateRequest struct {
+	URL        *string    `json:"url"`
+	Title      *string    `json:"title"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	TTLSeconds int        `json:"ttl_seconds"`
+}
+
+// UpdateUserURL меняет адрес назначения, заголовок или срок действия ссылки владельца
+func UpdateUserURL(c *gin.Context, cfg *config.Config) {
+	if !strings.HasPrefix(c.Request.Header.Get("Content-Type"), "application/json") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Content-Type must be application/json"})
+		return
+	}
+
+	var input updateRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON"})
+		return
+	}
+
+	update := storage.LinkUpdate{Title: input.Title}
+	if input.URL != nil {
+		parsedURL, err := url.ParseRequestURI(*input.URL)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid URL"})
+			return
+		}
+		original := parsedURL.String()
+		update.OriginalURL = &original
+	}
+	expiresAt, err := shortener.ResolveExpiry(input.ExpiresAt, input.TTLSeconds)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid expires_at or ttl_seconds"})
+		return
+	}
+	update.ExpiresAt = expiresAt
+	if update.OriginalURL == nil && update.Title == nil && update.ExpiresAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to update"})
+		return
+	}
+
+	key, userID, ok := requireOwner(c, cfg)
+	if !ok {
+		return
+	}
+
+	applyUpdate(c, cfg, key, userID, update)
+}
+
+// applyUpdate сохраняет изменения ссылки и отвечает клиенту её новым состоянием
+func applyUpdate(c *gin.Context, cfg *config.Config, key string, userID int, update storage.LinkUpdate) {
+	info, err := shortener.UpdateLink(c.Request.Context(), cfg, key, userID, update)
+	if err != nil {
+		if policyError(c, err) || blockedError(c, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, storage.ErrURLNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "URL not found"})
+		case errors.Is(err, storage.ErrURLDeleted):
+			c.JSON(http.StatusGone, gin.H{"error": "URL deleted"})
+		case errors.Is(err, storage.ErrURLAlreadyExists):
+			c.JSON(http.StatusConflict, gin.H{"error": "URL already shortened"})
+		default:
+			cfg.Sugar.Error(err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Problem service"})
+		}
+		return
+	}
+
+	info.ShortURL = cfg.FlagBaseURL + info.ShortURL
+	c.JSON(http.StatusOK, info)
+}
@@ -1,6 +1,9 @@
 package jwtauth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
@@ -31,3 +34,68 @@ func BuildJWTString(userID int) (string, error) {
 
 	return tokenString, nil
 }
+
+var ErrInvalidToken = errors.New("невалидный токен")
+
+func ParseJWTString(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(SecretKEY), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Токен пользователя выдаётся без аудитории: доступ к ссылке подписан тем же ключом, но пользователя не удостоверяет
+	if !token.Valid || claims.UserID <= 0 || len(claims.Audience) > 0 {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+// LinkAccessEXP — срок, в течение которого ссылка с паролем открывается без повторного ввода
+const LinkAccessEXP = 30 * time.Minute
+
+// linkAccessAudience отличает доступ к ссылке от токена пользователя
+const linkAccessAudience = "link_access"
+
+// LinkAccessClaims подтверждают, что пароль ссылки Subject уже введён.
+// PasswordTag привязывает доступ к паролю: после пересоздания ссылки прежний доступ недействителен.
+type LinkAccessClaims struct {
+	jwt.RegisteredClaims
+	PasswordTag string
+}
+
+// BuildLinkAccessString выдаёт доступ к ссылке short с паролем, хеш которого passwordHash
+func BuildLinkAccessString(short string, passwordHash string) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, LinkAccessClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   short,
+			Audience:  jwt.ClaimStrings{linkAccessAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(LinkAccessEXP)),
+		},
+		PasswordTag: passwordTag(passwordHash),
+	})
+	return token.SignedString([]byte(SecretKEY))
+}
+
+// CheckLinkAccess проверяет, что tokenString выдан BuildLinkAccessString для той же ссылки и пароля и не истёк
+func CheckLinkAccess(tokenString string, short string, passwordHash string) error {
+	claims := &LinkAccessClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(SecretKEY), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Name}))
+	if err != nil {
+		return err
+	}
+	if !token.Valid || claims.ExpiresAt == nil || !claims.VerifyAudience(linkAccessAudience, true) || claims.Subject != short || claims.PasswordTag != passwordTag(passwordHash) {
+		return ErrInvalidToken
+	}
+	return nil
+}
+
+func passwordTag(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
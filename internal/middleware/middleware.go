@@ -1,7 +1,6 @@
 package middleware
 
 import (
-	"bytes"
 	"compress/gzip"
 	"io"
 	"net/http"
@@ -11,16 +10,15 @@ import (
 	jwtauth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
 
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
 type (
 	responseData struct {
 		status int
 		size   int
-		body   *bytes.Buffer
 	}
 	loggingResponseWriter struct {
 		gin.ResponseWriter
@@ -40,7 +38,6 @@ func WithLogging(cfg *config.Config) gin.HandlerFunc {
 		responseData := &responseData{
 			status: 0,
 			size:   0,
-			body:   new(bytes.Buffer),
 		}
 		lw := &loggingResponseWriter{
 			ResponseWriter: c.Writer,
@@ -105,53 +102,26 @@ func AuthMiddleware(cfg *config.Config) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		jwtToken, err := c.Cookie("jwt")
 		if err != nil || jwtToken == "" {
-			cx := c.Request.Context()
-			newUser, err := cfg.Store.GetNewUser(cx)
+			jwtToken, err = shortener.RegisterUser(c.Request.Context(), cfg)
 			if err != nil {
 				cfg.Sugar.Error("Ошибка создания нового пользователя:", err)
 				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
 				return
 			}
-
-			token, err := jwtauth.BuildJWTString(newUser)
-			if err != nil {
-				cfg.Sugar.Error("Ошибка генерации JWT:", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
-				return
-			}
-
-			err = cfg.Store.SaveUser(cx, newUser)
-
-			if err != nil {
-				cfg.Sugar.Error("Ошибка сохранения пользовалтеля", err)
-				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Ошибка сервера"})
-				return
-			}
-
-			jwtToken = token
 		}
 
-		claims := &jwtauth.Claims{}
-		token, err := jwt.ParseWithClaims(jwtToken, claims, func(t *jwt.Token) (interface{}, error) {
-			return []byte(jwtauth.SecretKEY), nil
-		})
+		claims, err := jwtauth.ParseJWTString(jwtToken)
 		if err != nil {
 			cfg.Sugar.Error("Ошибка парсинга JWT:", err)
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Недействительный токен"})
 			return
 		}
-
-		if !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Невалидный токен"})
-			return
-		}
 		c.SetCookie("jwt", jwtToken, 3600, "/", "", false, false)
 		c.Set("user", claims)
 		c.Next()
 	}
 }
 func (w *loggingResponseWriter) Write(b []byte) (int, error) {
-	w.responseData.body.Write(b)
 	size, err := w.ResponseWriter.Write(b)
 	w.responseData.size += size
 	return size, err
@@ -162,6 +132,15 @@ func (w *loggingResponseWriter) WriteHeader(statusCode int) {
 	w.ResponseWriter.WriteHeader(statusCode)
 }
 
+// Unwrap даёт http.ResponseController добраться до соединения, например для полнодуплексного режима
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (g *gzipResponseWriter) Unwrap() http.ResponseWriter {
+	return g.ResponseWriter
+}
+
 func (g *gzipResponseWriter) Write(data []byte) (int, error) {
 	contentType := g.Header().Get("Content-Type")
 	if strings.HasPrefix(contentType, "application/json") || strings.HasPrefix(contentType, "text/html") {
@@ -0,0 +1,69 @@
+// Package ratelimit ограничивает число попыток по ключу в скользящем окне
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter разрешает не больше limit попыток по одному ключу за окно window
+type Limiter struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	attempts map[string][]time.Time
+}
+
+// New создаёт Limiter. limit <= 0 снимает ограничение.
+func New(limit int, window time.Duration) *Limiter {
+	return &Limiter{limit: limit, window: window, now: time.Now, attempts: map[string][]time.Time{}}
+}
+
+// Allow учитывает попытку по ключу и сообщает, укладывается ли она в ограничение.
+// Отклонённые попытки не учитываются, поэтому ключ освобождается через window после последней разрешённой.
+func (l *Limiter) Allow(key string) bool {
+	if l.limit <= 0 {
+		return true
+	}
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	recent := l.recent(key, now)
+	if len(recent) >= l.limit {
+		l.attempts[key] = recent
+		return false
+	}
+	l.attempts[key] = append(recent, now)
+	// Ключи без свежих попыток иначе копились бы без конца
+	if len(l.attempts) > cleanupThreshold {
+		l.cleanup(now)
+	}
+	return true
+}
+
+// cleanupThreshold — число ключей, после которого Allow выбрасывает устаревшие
+const cleanupThreshold = 1024
+
+// recent возвращает попытки по ключу, попадающие в окно. Вызывается под блокировкой.
+func (l *Limiter) recent(key string, now time.Time) []time.Time {
+	attempts := l.attempts[key]
+	start := 0
+	for start < len(attempts) && !attempts[start].After(now.Add(-l.window)) {
+		start++
+	}
+	return attempts[start:]
+}
+
+func (l *Limiter) cleanup(now time.Time) {
+	for key := range l.attempts {
+		if recent := l.recent(key, now); len(recent) == 0 {
+			delete(l.attempts, key)
+		} else {
+			l.attempts[key] = recent
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package ratelimit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.Allow("a"))
+	now = now.Add(30 * time.Second)
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+	// Ключи ограничиваются независимо
+	assert.True(t, limiter.Allow("b"))
+
+	// Окно скользящее: освобождается по мере устаревания попыток
+	now = now.Add(31 * time.Second)
+	assert.True(t, limiter.Allow("a"))
+	assert.False(t, limiter.Allow("a"))
+}
+
+func TestLimiterCleanup(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := New(1, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < cleanupThreshold; i++ {
+		limiter.Allow(fmt.Sprint(i))
+	}
+	now = now.Add(2 * time.Minute)
+	assert.True(t, limiter.Allow("fresh"))
+	assert.Len(t, limiter.attempts, 1)
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	limiter := New(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		assert.True(t, limiter.Allow("a"))
+	}
+}
@@ -0,0 +1,43 @@
+package shortener
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	aliasMinLength = 3
+	aliasMaxLength = 64
+)
+
+var (
+	ErrInvalidAlias  = errors.New("алиас содержит недопустимые символы или имеет неверную длину")
+	ErrReservedAlias = errors.New("алиас зарезервирован")
+)
+
+// reservedAliases — первые сегменты путей, которые заняты маршрутами сервиса
+var reservedAliases = map[string]bool{
+	"api":   true,
+	"ping":  true,
+	"admin": true,
+	"debug": true,
+}
+
+// ValidateAlias проверяет пользовательский короткий код:
+// латиница, цифры, "-" и "_", длина от 3 до 64 символов, не из списка зарезервированных.
+func ValidateAlias(alias string) error {
+	if len(alias) < aliasMinLength || len(alias) > aliasMaxLength {
+		return ErrInvalidAlias
+	}
+	for _, r := range alias {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+		default:
+			return ErrInvalidAlias
+		}
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return ErrReservedAlias
+	}
+	return nil
+}
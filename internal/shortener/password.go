@@ -0,0 +1,61 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidPassword = errors.New("пароль ссылки длиннее 72 байт")
+	ErrWrongPassword   = errors.New("неверный пароль ссылки")
+	ErrTooManyAttempts = errors.New("слишком много попыток ввода пароля")
+)
+
+// HashPassword возвращает солёный хеш bcrypt пароля ссылки, пустой пароль — пустой хеш
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrInvalidPassword
+	}
+	return string(hash), err
+}
+
+// UnlockLink проверяет пароль защищённой ссылки с учётом ограничения числа попыток.
+// Попытки считаются по ссылке, а не по клиенту: перебор с разных адресов ограничен так же.
+func UnlockLink(cfg *config.Config, link *storage.LinkInfo, password string) error {
+	if cfg.PasswordLimiter != nil && !cfg.PasswordLimiter.Allow(link.ShortURL) {
+		return ErrTooManyAttempts
+	}
+	if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// ResolveLink возвращает действующую ссылку по короткому коду.
+// Удалённая или истёкшая ссылка возвращается вместе с storage.ErrURLDeleted или storage.ErrURLExpired,
+// ссылка, адрес которой попал под списки блокировки уже после сокращения, — с ошибкой, совместимой с vetting.ErrBlocked.
+func ResolveLink(ctx context.Context, cfg *config.Config, key string) (*storage.LinkInfo, error) {
+	link, found, err := cfg.Store.Get(ctx, key)
+	switch {
+	case errors.Is(err, storage.ErrURLDeleted) || errors.Is(err, storage.ErrURLExpired):
+		return &link, err
+	case err != nil:
+		return nil, err
+	case !found:
+		return nil, storage.ErrURLNotFound
+	}
+	if err := Vet(ctx, cfg, link.OriginalURL); errors.Is(err, vetting.ErrBlocked) {
+		return &link, err
+	}
+	return &link, nil
+}
@@ -0,0 +1,214 @@
+// Package policy ограничивает адреса назначения, которые разрешено сокращать в данном развёртывании:
+// схемы, длину адреса, список разрешённых хостов и адреса во внутренних сетях.
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSchemeNotAllowed   = errors.New("схема адреса не разрешена")
+	ErrURLTooLong         = errors.New("адрес слишком длинный")
+	ErrHostNotAllowed     = errors.New("хост не входит в список разрешённых")
+	ErrPrivateDestination = errors.New("адрес ведёт во внутреннюю сеть")
+	ErrUnresolvableHost   = errors.New("не удалось разрешить имя хоста")
+)
+
+// codes — машиночитаемые коды ошибок политики для ответов клиенту
+var codes = []struct {
+	err  error
+	code string
+}{
+	{ErrSchemeNotAllowed, "scheme_not_allowed"},
+	{ErrURLTooLong, "url_too_long"},
+	{ErrHostNotAllowed, "host_not_allowed"},
+	{ErrPrivateDestination, "private_destination"},
+	{ErrUnresolvableHost, "unresolvable_host"},
+}
+
+// Code возвращает код ошибки политики; ok == false, если err не из этого пакета
+func Code(err error) (code string, ok bool) {
+	for _, c := range codes {
+		if errors.Is(err, c.err) {
+			return c.code, true
+		}
+	}
+	return "", false
+}
+
+// DefaultSchemes — схемы, разрешённые по умолчанию
+var DefaultSchemes = []string{"http", "https"}
+
+// DefaultMaxLength — ограничение длины адреса по умолчанию
+const DefaultMaxLength = 2048
+
+// lookupTimeout ограничивает разрешение имени хоста при проверке
+const lookupTimeout = 3 * time.Second
+
+// Resolver разрешает имена хостов, его реализует *net.Resolver
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy проверяет адрес назначения. Нулевые значения полей снимают соответствующее ограничение.
+type Policy struct {
+	// Schemes — разрешённые схемы
+	Schemes []string
+	// MaxLength — наибольшая длина адреса в байтах
+	MaxLength int
+	// AllowedHosts — разрешённые хосты, их поддомены тоже разрешены
+	AllowedHosts []string
+	// BlockPrivate запрещает loopback, частные, link-local и другие внутренние адреса
+	BlockPrivate bool
+	// Resolver, если задан, разрешает имя хоста, и BlockPrivate проверяет все его адреса
+	Resolver Resolver
+}
+
+// Check проверяет уже разобранный и канонизированный адрес
+func (p *Policy) Check(ctx context.Context, rawURL string) error {
+	if p.MaxLength > 0 && len(rawURL) > p.MaxLength {
+		return ErrURLTooLong
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if len(p.Schemes) > 0 && !contains(p.Schemes, u.Scheme) {
+		return ErrSchemeNotAllowed
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if len(p.AllowedHosts) > 0 && !matchHost(p.AllowedHosts, host) {
+		return ErrHostNotAllowed
+	}
+	if !p.BlockPrivate {
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateDestination
+	}
+	ip, numeric, err := parseIPv4(host)
+	if err != nil {
+		return ErrUnresolvableHost
+	}
+	if !numeric {
+		ip = net.ParseIP(host)
+	}
+	if ip != nil {
+		if isPrivate(ip) {
+			return ErrPrivateDestination
+		}
+		return nil
+	}
+	if p.Resolver == nil || host == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, lookupTimeout)
+	defer cancel()
+	addrs, err := p.Resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return ErrUnresolvableHost
+	}
+	// Достаточно одного внутреннего адреса: соединение может уйти на любой из них
+	for _, addr := range addrs {
+		if isPrivate(addr.IP) {
+			return ErrPrivateDestination
+		}
+	}
+	return nil
+}
+
+// parseIPv4 разбирает хост как IPv4 так же, как браузеры (WHATWG URL): от одной до четырёх частей
+// в десятичной, шестнадцатеричной (0x) или восьмеричной (ведущий 0) записи, последняя часть занимает
+// оставшиеся байты. Так http://2130706433/, http://0x7f000001/ и http://0177.0.0.1/ ведут на 127.0.0.1.
+// numeric == false — хост не IPv4; ошибка — хост похож на IPv4, но браузер такой адрес не откроет.
+func parseIPv4(host string) (ip net.IP, numeric bool, err error) {
+	// Хост IPv6 тоже может оканчиваться числом после точки
+	if strings.Contains(host, ":") {
+		return nil, false, nil
+	}
+	parts := strings.Split(host, ".")
+	last := parts[len(parts)-1]
+	if _, ok := parseIPv4Number(last); !ok && (last == "" || strings.Trim(last, "0123456789") != "") {
+		return nil, false, nil
+	}
+	if len(parts) > 4 {
+		return nil, true, errInvalidIPv4
+	}
+
+	numbers := make([]uint64, len(parts))
+	for i, part := range parts {
+		n, ok := parseIPv4Number(part)
+		if !ok {
+			return nil, true, errInvalidIPv4
+		}
+		numbers[i] = n
+	}
+	address := numbers[len(numbers)-1]
+	if address >= 1<<(8*(5-len(numbers))) {
+		return nil, true, errInvalidIPv4
+	}
+	for i, n := range numbers[:len(numbers)-1] {
+		if n > 255 {
+			return nil, true, errInvalidIPv4
+		}
+		address += n << (8 * (3 - i))
+	}
+	return net.IPv4(byte(address>>24), byte(address>>16), byte(address>>8), byte(address)), true, nil
+}
+
+var errInvalidIPv4 = errors.New("некорректный адрес IPv4")
+
+func parseIPv4Number(part string) (uint64, bool) {
+	if part == "" {
+		return 0, false
+	}
+	base := 10
+	switch {
+	case len(part) >= 2 && (part[:2] == "0x" || part[:2] == "0X"):
+		part, base = part[2:], 16
+	case len(part) >= 2 && part[0] == '0':
+		part, base = part[1:], 8
+	}
+	if part == "" {
+		return 0, true
+	}
+	// ParseUint допускает знаки подчёркивания только при нулевом основании, а знак не допускает вовсе
+	n, err := strconv.ParseUint(part, base, 64)
+	return n, err == nil
+}
+
+// sharedAddressSpace — 100.64.0.0/10 из RFC 6598, net.IP.IsPrivate её не учитывает
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+func isPrivate(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip)
+}
+
+func contains(items []string, item string) bool {
+	for _, candidate := range items {
+		if strings.EqualFold(candidate, item) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchHost(allowed []string, host string) bool {
+	for _, domain := range allowed {
+		domain = strings.TrimSuffix(strings.ToLower(domain), ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
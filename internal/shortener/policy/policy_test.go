@@ -0,0 +1,85 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := r[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	addrs := make([]net.IPAddr, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestPolicy(t *testing.T) {
+	base := Policy{Schemes: DefaultSchemes, MaxLength: 64, BlockPrivate: true}
+	withDNS := base
+	withDNS.Resolver = fakeResolver{
+		"public.example":   {"93.184.216.34"},
+		"internal.example": {"93.184.216.34", "10.0.0.5"},
+	}
+	allowList := base
+	allowList.AllowedHosts = []string{"example.com", "docs.example.org"}
+
+	tests := []struct {
+		name   string
+		policy Policy
+		url    string
+		want   error
+	}{
+		{"Public URL", base, "https://example.com/page", nil},
+		{"JavaScript", base, "javascript://comment/%0Aalert(1)", ErrSchemeNotAllowed},
+		{"File", base, "file:///etc/passwd", ErrSchemeNotAllowed},
+		{"Scheme case", base, "HTTPS://example.com/", nil},
+		{"Too long", base, "https://example.com/" + strings.Repeat("a", 64), ErrURLTooLong},
+		{"Loopback", base, "http://127.0.0.1/admin", ErrPrivateDestination},
+		{"Private", base, "http://192.168.1.1/", ErrPrivateDestination},
+		{"Link-local", base, "http://169.254.169.254/latest/meta-data", ErrPrivateDestination},
+		{"IPv6 loopback", base, "http://[::1]:8080/", ErrPrivateDestination},
+		{"IPv4-mapped IPv6", base, "http://[::ffff:10.0.0.1]/", ErrPrivateDestination},
+		{"Shared address space", base, "http://100.64.0.1/", ErrPrivateDestination},
+		{"Localhost", base, "http://localhost/", ErrPrivateDestination},
+		{"Decimal IPv4", base, "http://2130706433/", ErrPrivateDestination},
+		{"Hex IPv4", base, "http://0x7f000001/", ErrPrivateDestination},
+		{"Octal IPv4", base, "http://0177.0.0.1/", ErrPrivateDestination},
+		{"Short IPv4", base, "http://10.1/", ErrPrivateDestination},
+		{"Mixed IPv4", base, "http://0xa9.0376.43518/", ErrPrivateDestination},
+		{"Public decimal IPv4", base, "http://1572395042/", nil},
+		{"Invalid numeric host", base, "http://1.2.3.256/", ErrUnresolvableHost},
+		{"Numeric label", base, "http://example.123abc/", nil},
+		{"Name without DNS", base, "http://internal.example/", nil},
+		{"Private allowed", Policy{}, "http://127.0.0.1/", nil},
+		{"Resolved public", withDNS, "http://public.example/", nil},
+		{"Resolved private", withDNS, "http://internal.example/", ErrPrivateDestination},
+		{"Unresolvable", withDNS, "http://missing.example/", ErrUnresolvableHost},
+		{"Allowed host", allowList, "https://example.com/", nil},
+		{"Allowed subdomain", allowList, "https://www.example.com/", nil},
+		{"Host not allowed", allowList, "https://example.org/", ErrHostNotAllowed},
+		{"Lookalike host", allowList, "https://badexample.com/", ErrHostNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(context.Background(), tt.url)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+			_, ok := Code(err)
+			assert.True(t, ok)
+		})
+	}
+}
@@ -5,21 +5,36 @@ import (
 
 	"encoding/json"
 	"errors"
-	"math/rand"
-	"strings"
+	"fmt"
+	"net/url"
+	"time"
 
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	jwtauth "github.com/skakunma/go-musthave-shortener-tpl/internal/jwt"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/shortener/policy"
 	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/vetting"
 )
 
-var ErrURLAlreadyExists = errors.New("URL уже существует в базе данных")
+var (
+	ErrURLAlreadyExists = errors.New("URL уже существует в базе данных")
+	ErrInvalidExpiry    = errors.New("некорректный срок действия ссылки")
+	ErrInvalidBatchItem = errors.New("в пакете есть ссылка без correlation_id или original_url")
+	ErrInvalidURL       = errors.New("некорректный URL")
+	ErrNoFreeCode       = errors.New("не удалось подобрать свободный короткий код")
+)
 
 type (
 	ShortenTextFile struct {
-		UUID        string `json:"uuid"`
-		ShortURL    string `json:"short_url"`
-		OriginalURL string `json:"original_url"`
-		UserID      int    `json:"user_id"`
+		UUID         string     `json:"uuid"`
+		ShortURL     string     `json:"short_url"`
+		OriginalURL  string     `json:"original_url"`
+		SubmittedURL string     `json:"submitted_url,omitempty"`
+		PasswordHash string     `json:"password_hash,omitempty"`
+		UserID       int        `json:"user_id"`
+		ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+		Title        string     `json:"title,omitempty"`
+		UpdatedFlag  bool       `json:"is_updated,omitempty"`
 	}
 )
 
@@ -32,47 +47,340 @@ func (info *ShortenTextFile) SaveURLInfo(cfg *config.Config) error {
 	return nil
 }
 
-func GenerateLink(cfg *config.Config) string {
-	var builder strings.Builder
-	builder.Grow(cfg.CharsetLength)
+// Canonicalize проверяет адрес и приводит его к канонической форме по правилам из конфигурации.
+// submitted — адрес в присланном виде, если канонизация его изменила, иначе пустая строка.
+func Canonicalize(cfg *config.Config, raw string) (canonical string, submitted string, err error) {
+	if cfg.Canonicalizer == nil {
+		if _, err := url.ParseRequestURI(raw); err != nil {
+			return "", "", ErrInvalidURL
+		}
+		return raw, "", nil
+	}
+	canonical, err = cfg.Canonicalizer.Canonicalize(raw)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	if canonical != raw {
+		submitted = raw
+	}
+	return canonical, submitted, nil
+}
 
-	for i := 0; i < cfg.CharsetLength; i++ {
-		indx := rand.Intn(len(cfg.Charset) - 1)
-		builder.WriteByte(cfg.Charset[indx])
+// CheckDestination проверяет адрес назначения по политике развёртывания и не даёт сократить адрес самого сервиса.
+// Нарушение политики возвращает ошибку из пакета policy, ссылка на сервис — vetting.ErrBlocked.
+func CheckDestination(ctx context.Context, cfg *config.Config, original string) error {
+	if err := vetting.CheckSelfReference(cfg.FlagBaseURL, original); err != nil {
+		return err
+	}
+	if cfg.Policy == nil {
+		return nil
+	}
+	return cfg.Policy.Check(ctx, original)
+}
+
+// Vet проверяет адрес назначения стадиями проверки из конфигурации.
+// Заблокированный адрес возвращает ошибку, совместимую с vetting.ErrBlocked.
+func Vet(ctx context.Context, cfg *config.Config, original string) error {
+	if cfg.Vetter == nil {
+		return nil
 	}
+	return cfg.Vetter.Check(ctx, original)
+}
 
-	return builder.String()
+// PrepareDestination канонизирует адрес назначения, проверяет его по политике, разворачивает
+// ссылки других сокращателей и проверяет итоговый адрес стадиями проверки.
+// submitted — адрес в присланном виде, если сохраняемый адрес от него отличается.
+func PrepareDestination(ctx context.Context, cfg *config.Config, raw string) (original string, submitted string, err error) {
+	original, submitted, err = Canonicalize(cfg, raw)
+	if err != nil {
+		return "", "", err
+	}
+	if err := CheckDestination(ctx, cfg, original); err != nil {
+		return "", "", err
+	}
+	if cfg.Unwrapper != nil {
+		unwrapped, err := cfg.Unwrapper.Unwrap(ctx, original)
+		if err != nil {
+			return "", "", err
+		}
+		if unwrapped != original {
+			if original, _, err = Canonicalize(cfg, unwrapped); err != nil {
+				return "", "", err
+			}
+			// Конечный адрес сокращателя проверяется заново: он мог вести на сам сервис или во внутреннюю сеть
+			if err := CheckDestination(ctx, cfg, original); err != nil {
+				return "", "", err
+			}
+			submitted = raw
+		}
+	}
+	if err := Vet(ctx, cfg, original); err != nil {
+		return "", "", err
+	}
+	return original, submitted, nil
 }
-func AddLink(ctx context.Context, cfg *config.Config, Link string, uuid string, UserID int) (string, error) {
-	cfg.Mu.Lock()
-	defer cfg.Mu.Unlock()
 
-	for {
-		randomLink := GenerateLink(cfg)
+// GenerateLink выдаёт новый короткий код стратегией из конфигурации.
+// attempt > 0 — повторная попытка после коллизии.
+func GenerateLink(ctx context.Context, cfg *config.Config, original string, attempt int) (string, error) {
+	return cfg.Generator.Generate(ctx, original, attempt)
+}
 
-		if _, exist, _ := cfg.Store.Get(ctx, randomLink); !exist {
-			shortenLink, err := cfg.Store.Save(ctx, uuid, randomLink, Link, UserID)
-			if err != nil {
-				if errors.Is(err, storage.ErrURLAlreadyExists) {
-					return cfg.FlagBaseURL + shortenLink, err
-				}
-				return "", err
+// RegisterUser заводит нового пользователя и возвращает его JWT
+func RegisterUser(ctx context.Context, cfg *config.Config) (string, error) {
+	newUser, err := cfg.Store.GetNewUser(ctx)
+	if err != nil {
+		return "", fmt.Errorf("ошибка создания нового пользователя: %w", err)
+	}
+
+	token, err := jwtauth.BuildJWTString(newUser)
+	if err != nil {
+		return "", fmt.Errorf("ошибка генерации JWT: %w", err)
+	}
+
+	if err := cfg.Store.SaveUser(ctx, newUser); err != nil {
+		return "", fmt.Errorf("ошибка сохранения пользователя: %w", err)
+	}
+
+	return token, nil
+}
+
+// ResolveExpiry приводит expires_at и ttl_seconds из запроса к моменту истечения ссылки.
+// nil означает бессрочную ссылку.
+func ResolveExpiry(expiresAt *time.Time, ttlSeconds int) (*time.Time, error) {
+	if expiresAt != nil && ttlSeconds != 0 {
+		return nil, ErrInvalidExpiry
+	}
+	if ttlSeconds < 0 {
+		return nil, ErrInvalidExpiry
+	}
+	if ttlSeconds > 0 {
+		expiry := time.Now().Add(time.Duration(ttlSeconds) * time.Second).UTC()
+		return &expiry, nil
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, ErrInvalidExpiry
+	}
+	return expiresAt, nil
+}
+
+// maxGenerateAttempts ограничивает повторы генерации кодов, совпавших с уже занятыми
+const maxGenerateAttempts = 5
+
+// AddLink сокращает адрес. Непустой password защищает ссылку паролем.
+func AddLink(ctx context.Context, cfg *config.Config, Link string, uuid string, UserID int, expiresAt *time.Time, password string) (string, error) {
+	Link, submitted, err := PrepareDestination(ctx, cfg, Link)
+	if err != nil {
+		return "", err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	// Хранилище атомарно отказывает в занятом коде, поэтому заранее проверять его не нужно.
+	// Повтор возможен только для случайной и хеш-стратегий или при совпадении с алиасом;
+	// число повторов ограничено, как и для пакетов, чтобы исчерпанное пространство кодов не зациклило запрос.
+	for attempt := 0; attempt < maxGenerateAttempts; attempt++ {
+		randomLink, err := GenerateLink(ctx, cfg, Link, attempt)
+		if err != nil {
+			return "", err
+		}
+
+		link, err := saveLink(ctx, cfg, Link, submitted, passwordHash, randomLink, uuid, UserID, expiresAt)
+		if errors.Is(err, storage.ErrShortURLTaken) {
+			continue
+		}
+		return link, err
+	}
+	return "", ErrNoFreeCode
+}
+
+// AddAlias сохраняет ссылку под выбранным пользователем коротким кодом.
+// Цикл подбора не нужен: занятость алиаса атомарно проверяет хранилище.
+func AddAlias(ctx context.Context, cfg *config.Config, Link string, alias string, uuid string, UserID int, expiresAt *time.Time, password string) (string, error) {
+	if err := ValidateAlias(alias); err != nil {
+		return "", err
+	}
+	Link, submitted, err := PrepareDestination(ctx, cfg, Link)
+	if err != nil {
+		return "", err
+	}
+	passwordHash, err := HashPassword(password)
+	if err != nil {
+		return "", err
+	}
+	return saveLink(ctx, cfg, Link, submitted, passwordHash, alias, uuid, UserID, expiresAt)
+}
+
+func saveLink(ctx context.Context, cfg *config.Config, Link string, submitted string, passwordHash string, short string, uuid string, UserID int, expiresAt *time.Time) (string, error) {
+	shortenLink, err := cfg.Store.Save(ctx, uuid, short, Link, submitted, passwordHash, UserID, expiresAt)
+	if err != nil {
+		if errors.Is(err, storage.ErrURLAlreadyExists) {
+			return cfg.FlagBaseURL + shortenLink, err
+		}
+		return "", err
+	}
+
+	url := ShortenTextFile{UUID: uuid, ShortURL: short, OriginalURL: Link, SubmittedURL: submitted, PasswordHash: passwordHash, UserID: UserID, ExpiresAt: expiresAt}
+	err = url.SaveURLInfo(cfg)
+	if err != nil {
+		return "", err
+	}
+	return cfg.FlagBaseURL + shortenLink, nil
+}
+
+// AddBatch проверяет ссылки пакета, выдаёт им короткие коды и сохраняет одной операцией.
+// Возвращает исход для каждой ссылки в порядке запроса: ошибка одной ссылки не отменяет остальные.
+// Ошибка возвращается, только если хранилище не смогло обработать пакет целиком.
+func AddBatch(ctx context.Context, cfg *config.Config, links []storage.InfoAboutURL, UserID int) ([]storage.BatchResult, error) {
+	results := make([]storage.BatchResult, len(links))
+	pending := make([]int, 0, len(links))
+	for i, link := range links {
+		results[i] = storage.BatchResult{CorrelationID: link.CorrelationID}
+		if err := prepareBatchItem(ctx, cfg, &links[i], 0); err != nil {
+			results[i].Status, results[i].Err = storage.BatchInvalid, err
+			switch {
+			case errors.Is(err, vetting.ErrBlocked):
+				results[i].Status = storage.BatchBlocked
+			case !isInvalidItem(err):
+				results[i].Status = storage.BatchError
 			}
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	for attempt := 1; len(pending) > 0; attempt++ {
+		batch := make([]storage.InfoAboutURL, len(pending))
+		for j, i := range pending {
+			batch[j] = links[i]
+		}
+		stored, err := cfg.Store.AddLinksBatch(ctx, batch, UserID)
+		if err != nil {
+			return nil, err
+		}
 
-			url := ShortenTextFile{UUID: uuid, ShortURL: randomLink, OriginalURL: Link, UserID: UserID}
-			err = url.SaveURLInfo(cfg)
-			if err != nil {
-				return "", err
+		var created []storage.InfoAboutURL
+		var retry []int
+		for j, i := range pending {
+			results[i] = stored[j]
+			switch {
+			case stored[j].Status == storage.BatchCreated:
+				created = append(created, links[i])
+			// Сгенерированный код совпал с занятым — выдаём новый, алиас же занят окончательно
+			case errors.Is(stored[j].Err, storage.ErrShortURLTaken) && links[i].Alias == "" && attempt < maxGenerateAttempts:
+				if err := prepareBatchItem(ctx, cfg, &links[i], attempt); err != nil {
+					results[i].Err = err
+					continue
+				}
+				retry = append(retry, i)
 			}
-			return cfg.FlagBaseURL + shortenLink, nil
 		}
+		if err := SaveBatchInfo(cfg, created, UserID); err != nil {
+			cfg.Sugar.Error(err)
+		}
+		pending = retry
+	}
+	return results, nil
+}
+
+// prepareBatchItem проверяет ссылку пакета и выдаёт ей короткий код
+func prepareBatchItem(ctx context.Context, cfg *config.Config, link *storage.InfoAboutURL, attempt int) error {
+	if link.OriginalURL == "" || link.CorrelationID == "" {
+		return ErrInvalidBatchItem
+	}
+	if attempt == 0 {
+		original, submitted, err := PrepareDestination(ctx, cfg, link.OriginalURL)
+		if err != nil {
+			return err
+		}
+		link.OriginalURL, link.SubmittedURL = original, submitted
+
+		expiresAt, err := ResolveExpiry(link.ExpiresAt, link.TTLSeconds)
+		if err != nil {
+			return err
+		}
+		link.ExpiresAt = expiresAt
+
+		// Пароль хешируется один раз, открытый текст дальше не передаётся
+		if link.PasswordHash, err = HashPassword(link.Password); err != nil {
+			return err
+		}
+		link.Password = ""
 	}
+	if link.Alias != "" {
+		if err := ValidateAlias(link.Alias); err != nil {
+			return err
+		}
+		link.ShortLink = link.Alias
+		return nil
+	}
+	var err error
+	link.ShortLink, err = GenerateLink(ctx, cfg, link.OriginalURL, attempt)
+	return err
 }
 
-func GetLink(ctx context.Context, cfg *config.Config, key string) (string, bool) {
-	if value, exist, err := cfg.Store.Get(ctx, key); exist && err == nil {
-		return value, true
+// isInvalidItem отличает ошибки в данных ссылки от сбоев сервиса
+func isInvalidItem(err error) bool {
+	if _, ok := policy.Code(err); ok {
+		return true
 	}
+	return errors.Is(err, ErrInvalidBatchItem) ||
+		errors.Is(err, ErrInvalidURL) ||
+		errors.Is(err, ErrInvalidExpiry) ||
+		errors.Is(err, ErrInvalidPassword) ||
+		errors.Is(err, ErrInvalidAlias) ||
+		errors.Is(err, ErrReservedAlias)
+}
 
-	return "", false
+func SaveBatchInfo(cfg *config.Config, links []storage.InfoAboutURL, UserID int) error {
+	for _, link := range links {
+		info := ShortenTextFile{
+			UUID:         link.CorrelationID,
+			ShortURL:     link.ShortLink,
+			OriginalURL:  link.OriginalURL,
+			SubmittedURL: link.SubmittedURL,
+			PasswordHash: link.PasswordHash,
+			UserID:       UserID,
+			ExpiresAt:    link.ExpiresAt,
+		}
+		if err := info.SaveURLInfo(cfg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateLink меняет ссылку пользователя и дописывает изменение в файл.
+// Новый адрес назначения готовится и проверяется так же, как при сокращении.
+func UpdateLink(ctx context.Context, cfg *config.Config, short string, UserID int, update storage.LinkUpdate) (*storage.LinkInfo, error) {
+	if update.OriginalURL != nil && update.SubmittedURL == nil {
+		original, submitted, err := PrepareDestination(ctx, cfg, *update.OriginalURL)
+		if err != nil {
+			return nil, err
+		}
+		update.OriginalURL = &original
+		if submitted != "" {
+			update.SubmittedURL = &submitted
+		}
+	}
+	info, err := cfg.Store.Update(ctx, short, UserID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	record := ShortenTextFile{ShortURL: short, UserID: UserID, ExpiresAt: update.ExpiresAt, UpdatedFlag: true}
+	if update.OriginalURL != nil {
+		record.OriginalURL = *update.OriginalURL
+	}
+	if update.SubmittedURL != nil {
+		record.SubmittedURL = *update.SubmittedURL
+	}
+	if update.Title != nil {
+		record.Title = *update.Title
+	}
+	if err := record.SaveURLInfo(cfg); err != nil {
+		return nil, err
+	}
+	return info, nil
 }
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+)
+
+// NewCorrelationID выдаёт случайный идентификатор ссылки в формате UUID v4.
+// Номер по числу ссылок не годится: очистка истёкших ссылок уменьшает их число, и номера повторяются.
+func NewCorrelationID() string {
+	var b [16]byte
+	// crypto/rand читает из getrandom и на поддерживаемых платформах ошибок не возвращает
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("ошибка генерации идентификатора ссылки: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
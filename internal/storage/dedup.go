@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"errors"
+	"strconv"
+)
+
+// DedupScope — область, в пределах которой повторное сокращение адреса возвращает уже выданную ссылку
+type DedupScope string
+
+const (
+	// DedupGlobal — один адрес получает одну ссылку на весь сервис
+	DedupGlobal DedupScope = "global"
+	// DedupUser — у каждого пользователя своя ссылка на адрес
+	DedupUser DedupScope = "user"
+	// DedupNone — каждое сокращение создаёт новую ссылку
+	DedupNone DedupScope = "none"
+)
+
+var ErrUnknownDedupScope = errors.New("неизвестная область дедупликации")
+
+// ParseDedupScope разбирает значение флага -dedup-scope, пустое значение означает DedupUser
+func ParseDedupScope(value string) (DedupScope, error) {
+	switch scope := DedupScope(value); scope {
+	case "":
+		return DedupUser, nil
+	case DedupGlobal, DedupUser, DedupNone:
+		return scope, nil
+	}
+	return "", ErrUnknownDedupScope
+}
+
+// key возвращает ключ уникальности ссылки в Postgres.
+// nil означает, что ссылка не участвует в дедупликации.
+func (scope DedupScope) key(userID int, original string) *string {
+	switch scope {
+	case DedupGlobal:
+		return &original
+	case DedupUser:
+		key := strconv.Itoa(userID) + ":" + original
+		return &key
+	}
+	return nil
+}
+
+// keySQL — то же, что key, но выражением над строкой urls. Ссылки с паролем ключа не получают.
+func (scope DedupScope) keySQL() string {
+	switch scope {
+	case DedupGlobal:
+		return "CASE WHEN is_deleted OR password_hash IS NOT NULL THEN NULL ELSE original_url END"
+	case DedupUser:
+		return "CASE WHEN is_deleted OR password_hash IS NOT NULL THEN NULL ELSE user_id::text || ':' || original_url END"
+	}
+	return "NULL::text"
+}
@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	deleteBatchSize     = 100
+	deleteFlushInterval = time.Second
+	deleteQueueSize     = 1024
+)
+
+var ErrDeleterClosed = errors.New("очередь удаления остановлена")
+
+// Deleter собирает запросы на удаление из всех хендлеров в один канал
+// и отправляет их в хранилище пачками.
+type Deleter struct {
+	store    Storage
+	journal  io.Writer
+	sugar    *zap.SugaredLogger
+	requests chan DeleteRequest
+	done     chan struct{}
+	once     sync.Once
+	// mu не даёт Close закрыть канал, пока Enqueue в него пишет
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewDeleter(store Storage, journal io.Writer, sugar *zap.SugaredLogger) *Deleter {
+	d := &Deleter{
+		store:    store,
+		journal:  journal,
+		sugar:    sugar,
+		requests: make(chan DeleteRequest, deleteQueueSize),
+		done:     make(chan struct{}),
+	}
+	go d.run()
+	return d
+}
+
+// Enqueue ставит ссылки пользователя в очередь на удаление и не ждёт самого удаления.
+// Если очередь заполнена, ждёт места, пока не отменён ctx; после Close возвращает ErrDeleterClosed.
+func (d *Deleter) Enqueue(ctx context.Context, userID int, shortURLs []string) error {
+	if len(shortURLs) == 0 {
+		return nil
+	}
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrDeleterClosed
+	}
+	select {
+	case d.requests <- DeleteRequest{UserID: userID, ShortURLs: shortURLs}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close сбрасывает накопленные запросы и останавливает воркер
+func (d *Deleter) Close() {
+	d.once.Do(func() {
+		d.mu.Lock()
+		d.closed = true
+		close(d.requests)
+		d.mu.Unlock()
+		<-d.done
+	})
+}
+
+func (d *Deleter) run() {
+	defer close(d.done)
+
+	ticker := time.NewTicker(deleteFlushInterval)
+	defer ticker.Stop()
+
+	var batch []DeleteRequest
+	size := 0
+	for {
+		select {
+		case request, ok := <-d.requests:
+			if !ok {
+				d.flush(batch)
+				return
+			}
+			batch = append(batch, request)
+			size += len(request.ShortURLs)
+			if size < deleteBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		d.flush(batch)
+		batch = nil
+		size = 0
+	}
+}
+
+func (d *Deleter) flush(batch []DeleteRequest) {
+	if len(batch) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := d.store.DeleteUserLinks(ctx, batch); err != nil {
+		d.sugar.Error("Ошибка удаления ссылок:", err)
+		return
+	}
+
+	if d.journal == nil {
+		return
+	}
+	encoder := json.NewEncoder(d.journal)
+	for _, request := range batch {
+		for _, short := range request.ShortURLs {
+			record := ShortenTextFile{ShortURL: short, UserID: request.UserID, DeletedFlag: true}
+			if err := encoder.Encode(record); err != nil {
+				d.sugar.Error("Ошибка записи удаления в файл:", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// blockingStore задерживает удаление, пока тест не откроет release
+type blockingStore struct {
+	*LinkStorage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s *blockingStore) DeleteUserLinks(ctx context.Context, requests []DeleteRequest) error {
+	select {
+	case s.started <- struct{}{}:
+	default:
+	}
+	<-s.release
+	return s.LinkStorage.DeleteUserLinks(ctx, requests)
+}
+
+func TestDeleterEnqueue(t *testing.T) {
+	ctx := context.Background()
+	store := &blockingStore{LinkStorage: NewLinkStorage(), started: make(chan struct{}, 1), release: make(chan struct{})}
+	_, err := store.Save(ctx, "1", "queued", "https://example.com/queued", "", "", 1, nil)
+	require.NoError(t, err)
+	deleter := NewDeleter(store, nil, zap.NewNop().Sugar())
+
+	// Полная пачка уходит в хранилище сразу и занимает воркер
+	full := make([]string, deleteBatchSize)
+	for i := range full {
+		full[i] = "missing"
+	}
+	require.NoError(t, deleter.Enqueue(ctx, 1, full))
+	<-store.started
+	for i := 0; i < deleteQueueSize; i++ {
+		require.NoError(t, deleter.Enqueue(ctx, 1, []string{"queued"}))
+	}
+
+	// Переполненная очередь не держит запрос дольше его контекста
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, deleter.Enqueue(timeout, 1, []string{"queued"}), context.DeadlineExceeded)
+
+	// Close дожидается удаления уже принятых ссылок
+	close(store.release)
+	deleter.Close()
+	_, _, err = store.Get(ctx, "queued")
+	assert.ErrorIs(t, err, ErrURLDeleted)
+
+	assert.ErrorIs(t, deleter.Enqueue(ctx, 1, []string{"queued"}), ErrDeleterClosed)
+}
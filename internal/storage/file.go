@@ -4,16 +4,31 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
+	"time"
 )
 
 type ShortenTextFile struct {
-	UUID        string `json:"uuid"`
-	ShortURL    string `json:"short_url"`
-	OriginalURL string `json:"original_url"`
-	UserID      int    `json:"user_id"`
+	UUID         string     `json:"uuid"`
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	SubmittedURL string     `json:"submitted_url,omitempty"`
+	PasswordHash string     `json:"password_hash,omitempty"`
+	UserID       int        `json:"user_id"`
+	DeletedFlag  bool       `json:"is_deleted,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	UpdatedFlag  bool       `json:"is_updated,omitempty"`
+	IDBlock      *uint64    `json:"id_block,omitempty"`
+	// Поля перехода по ссылке: запись с ClickedAt описывает переход, а не ссылку
+	ClickedAt *time.Time `json:"clicked_at,omitempty"`
+	Referrer  string     `json:"referrer,omitempty"`
+	UserAgent string     `json:"user_agent,omitempty"`
+	IPHash    string     `json:"ip_hash,omitempty"`
 }
 
 func LoadLinksFromFile(ctx context.Context, store Storage, filePath string) error {
@@ -26,18 +41,84 @@ func LoadLinksFromFile(ctx context.Context, store Storage, filePath string) erro
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	return ReplayLinks(ctx, store, file, nil)
+}
+
+// ReplayLinks применяет к хранилищу записи журнала в формате JSON Lines.
+// Если journal не nil, каждая прочитанная запись дописывается в него.
+func ReplayLinks(ctx context.Context, store Storage, r io.Reader, journal io.Writer) error {
+	// replayed — адрес ссылки по уже прочитанной части журнала
+	replayed := map[string]string{}
+	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		var link ShortenTextFile
 		err := json.Unmarshal(scanner.Bytes(), &link)
 		if err != nil {
 			return fmt.Errorf("ошибка парсинга JSON: %w", err)
 		}
+		if journal != nil {
+			if _, err := journal.Write(append(scanner.Bytes(), '\n')); err != nil {
+				return fmt.Errorf("ошибка записи в журнал: %w", err)
+			}
+		}
+
+		if link.IDBlock != nil {
+			if err := store.ReserveIDBlock(ctx, *link.IDBlock); err != nil {
+				return fmt.Errorf("ошибка резервирования блока идентификаторов: %w", err)
+			}
+			continue
+		}
 
-		uuid := strconv.Itoa(store.Len(ctx))
+		if link.ClickedAt != nil {
+			// PostgreSQL хранит переходы сам, а восстановление журнала при каждом запуске размножило бы их
+			if _, durable := store.(*PostgresStorage); durable {
+				continue
+			}
+			if err := store.SaveClicks(ctx, []Click{link.click()}); err != nil {
+				return fmt.Errorf("ошибка восстановления перехода: %w", err)
+			}
+			continue
+		}
+
+		if link.DeletedFlag {
+			err := store.DeleteUserLinks(ctx, []DeleteRequest{{UserID: link.UserID, ShortURLs: []string{link.ShortURL}}})
+			if err != nil {
+				return fmt.Errorf("ошибка удаления ссылки: %w", err)
+			}
+			continue
+		}
+
+		if link.UpdatedFlag {
+			if !updatePending(ctx, store, replayed, &link) {
+				replayed[link.ShortURL] = link.OriginalURL
+				continue
+			}
+			_, err := store.Update(ctx, link.ShortURL, link.UserID, link.update())
+			switch {
+			case err == nil:
+				if link.OriginalURL != "" {
+					replayed[link.ShortURL] = link.OriginalURL
+				}
+			// Ссылка могла истечь или быть удалена после изменения, а её новый адрес — оказаться сокращённым другой ссылкой
+			case !errors.Is(err, ErrURLNotFound) && !errors.Is(err, ErrURLDeleted) && !errors.Is(err, ErrURLAlreadyExists):
+				return fmt.Errorf("ошибка обновления ссылки: %w", err)
+			}
+			continue
+		}
+
+		// Истёкшие ссылки не восстанавливаем
+		if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+			continue
+		}
+
+		uuid := link.UUID
+		if uuid == "" {
+			uuid = NewCorrelationID()
+		}
 		userID := link.UserID
+		replayed[link.ShortURL] = link.OriginalURL
 
-		store.Save(ctx, uuid, link.ShortURL, link.OriginalURL, userID)
+		store.Save(ctx, uuid, link.ShortURL, link.OriginalURL, link.SubmittedURL, link.PasswordHash, userID, link.ExpiresAt)
 	}
 
 	if err := scanner.Err(); err != nil {
@@ -46,3 +127,97 @@ func LoadLinksFromFile(ctx context.Context, store Storage, filePath string) erro
 
 	return nil
 }
+
+// updatePending сообщает, нужно ли применять запись журнала о смене адреса.
+// Долговременное хранилище, например PostgreSQL, уже содержит изменения, записанные до перезапуска:
+// если адрес в хранилище не тот, что по журналу был до этой записи, хранилище ушло дальше журнала,
+// и повторная смена адреса лишь добавила бы в историю ложные записи.
+func updatePending(ctx context.Context, store Storage, replayed map[string]string, link *ShortenTextFile) bool {
+	if link.OriginalURL == "" {
+		return true
+	}
+	before, known := replayed[link.ShortURL]
+	current, found, _ := store.Get(ctx, link.ShortURL)
+	if !known || !found {
+		return true
+	}
+	return current.OriginalURL == before
+}
+
+// DumpLinks пишет все ссылки хранилища в формате журнала, который читает ReplayLinks.
+// Возвращает число выгруженных ссылок.
+func DumpLinks(ctx context.Context, store Storage, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+	count := 0
+	err := store.ForEachLink(ctx, func(link LinkInfo) error {
+		if link.UUID == "" {
+			link.UUID = strconv.Itoa(count + 1)
+		}
+		for _, record := range journalRecords(link) {
+			if err := encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// journalRecords переводит ссылку в записи журнала.
+// Заголовок и удаление Save не переносит, поэтому они идут отдельными записями.
+func journalRecords(link LinkInfo) []ShortenTextFile {
+	records := []ShortenTextFile{{
+		UUID:         link.UUID,
+		ShortURL:     link.ShortURL,
+		OriginalURL:  link.OriginalURL,
+		SubmittedURL: link.SubmittedURL,
+		PasswordHash: link.PasswordHash,
+		UserID:       link.UserID,
+		ExpiresAt:    link.ExpiresAt,
+	}}
+	if link.Title != "" {
+		records = append(records, ShortenTextFile{ShortURL: link.ShortURL, UserID: link.UserID, Title: link.Title, UpdatedFlag: true})
+	}
+	if link.Deleted {
+		records = append(records, ShortenTextFile{ShortURL: link.ShortURL, UserID: link.UserID, DeletedFlag: true})
+	}
+	return records
+}
+
+// ClickRecord переводит переход в запись журнала
+func ClickRecord(click Click) ShortenTextFile {
+	return ShortenTextFile{
+		ShortURL:  click.ShortURL,
+		ClickedAt: &click.Time,
+		Referrer:  click.Referrer,
+		UserAgent: click.UserAgent,
+		IPHash:    click.IPHash,
+	}
+}
+
+// click восстанавливает переход из записи журнала
+func (link *ShortenTextFile) click() Click {
+	return Click{
+		ShortURL:  link.ShortURL,
+		Time:      *link.ClickedAt,
+		Referrer:  link.Referrer,
+		UserAgent: link.UserAgent,
+		IPHash:    link.IPHash,
+	}
+}
+
+// update восстанавливает изменения ссылки из записи журнала
+func (link *ShortenTextFile) update() LinkUpdate {
+	update := LinkUpdate{ExpiresAt: link.ExpiresAt}
+	if link.OriginalURL != "" {
+		update.OriginalURL = &link.OriginalURL
+	}
+	if link.SubmittedURL != "" {
+		update.SubmittedURL = &link.SubmittedURL
+	}
+	if link.Title != "" {
+		update.Title = &link.Title
+	}
+	return update
+}
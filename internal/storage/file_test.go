@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplayLinksIdempotent(t *testing.T) {
+	ctx := context.Background()
+	journal := strings.Join([]string{
+		`{"uuid":"1","short_url":"chain","original_url":"https://example.com/a","user_id":1}`,
+		`{"uuid":"","short_url":"chain","original_url":"https://example.com/b","user_id":1,"is_updated":true}`,
+		`{"uuid":"","short_url":"chain","original_url":"https://example.com/c","user_id":1,"is_updated":true}`,
+		`{"uuid":"2","short_url":"taken","original_url":"https://example.com/taken","user_id":1}`,
+		// Адрес уже сокращён другой ссылкой: изменение пропускается, а не прерывает восстановление
+		`{"uuid":"","short_url":"chain","original_url":"https://example.com/taken","user_id":1,"is_updated":true}`,
+	}, "\n")
+
+	store := NewLinkStorage()
+	require.NoError(t, store.SetDedupScope(ctx, DedupGlobal))
+	require.NoError(t, ReplayLinks(ctx, store, strings.NewReader(journal), nil))
+	link, _, err := store.Get(ctx, "chain")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/c", link.OriginalURL)
+	history, err := store.GetHistory(ctx, "chain")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+
+	// Повторное восстановление в хранилище, которое уже содержит изменения, как PostgreSQL при перезапуске
+	require.NoError(t, ReplayLinks(ctx, store, strings.NewReader(journal), nil))
+	link, _, err = store.Get(ctx, "chain")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/c", link.OriginalURL)
+	history, err = store.GetHistory(ctx, "chain")
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+}
@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// IDBlockSize — размер блока идентификаторов hi/lo. Должен совпадать у всех реплик.
+const IDBlockSize = 1000
+
+// IDBlocks выдаёт генератору блоки идентификаторов из хранилища
+// и записывает каждый выданный блок в файл, чтобы он не повторился после перезапуска.
+type IDBlocks struct {
+	store   Storage
+	journal io.Writer
+	mu      sync.Mutex
+}
+
+func NewIDBlocks(store Storage, journal io.Writer) *IDBlocks {
+	return &IDBlocks{store: store, journal: journal}
+}
+
+func (b *IDBlocks) NextIDBlock(ctx context.Context) (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	hi, err := b.store.NextIDBlock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if b.journal == nil {
+		return hi, nil
+	}
+	if err := json.NewEncoder(b.journal).Encode(ShortenTextFile{IDBlock: &hi}); err != nil {
+		return 0, fmt.Errorf("ошибка записи блока идентификаторов в файл: %w", err)
+	}
+	return hi, nil
+}
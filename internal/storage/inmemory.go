@@ -1,40 +1,134 @@
 package storage
 
-import "context"
+import (
+	"context"
+	"sort"
+	"time"
+)
 
 func NewLinkStorage() *LinkStorage {
 
-	return &LinkStorage{links: map[string]string{}, users: map[int]bool{}, userLinks: map[int][]string{}}
+	return &LinkStorage{links: map[string]*linkRecord{}, users: map[int]bool{}, userLinks: map[int][]string{}, byOriginal: map[string][]string{}, clicks: map[string][]Click{}, history: map[string][]HistoryEntry{}, dedup: DedupNone}
 }
 
+// SetDedupScope меняет область дедупликации для новых ссылок.
+// Уже сохранённые повторы остаются, а повторное сокращение получает самую раннюю из них.
+func (s *LinkStorage) SetDedupScope(ctx context.Context, scope DedupScope) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dedup = scope
+	return nil
+}
+
+// duplicate ищет действующую ссылку на адрес в области дедупликации, не считая except.
+// Ссылки с паролем в дедупликации не участвуют. Вызывается под блокировкой.
+func (s *LinkStorage) duplicate(original string, userID int, except string) (string, bool) {
+	if s.dedup != DedupGlobal && s.dedup != DedupUser {
+		return "", false
+	}
+	for _, short := range s.byOriginal[original] {
+		record := s.links[short]
+		if short == except || record.deleted || record.password != "" || (s.dedup == DedupUser && record.userID != userID) {
+			continue
+		}
+		return short, true
+	}
+	return "", false
+}
+
+// GetFromOriginal возвращает самую раннюю неудалённую короткую ссылку на адрес
 func (s *LinkStorage) GetFromOriginal(ctx context.Context, originalURL string) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 	default:
 	}
-	return originalURL, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, short := range s.byOriginal[originalURL] {
+		if !s.links[short].deleted {
+			return short, nil
+		}
+	}
+	return "", ErrURLNotFound
+}
+
+// GetLinksByOriginal возвращает все ссылки на адрес в порядке привязки к нему, включая удалённые и истёкшие
+func (s *LinkStorage) GetLinksByOriginal(ctx context.Context, originalURL string) ([]LinkInfo, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]LinkInfo, 0, len(s.byOriginal[originalURL]))
+	for _, short := range s.byOriginal[originalURL] {
+		links = append(links, *s.links[short].info(short))
+	}
+	return links, nil
 }
 
-func (s *LinkStorage) Save(ctx context.Context, correlationID string, short string, original string, userID int) (string, error) {
+func (s *LinkStorage) Save(ctx context.Context, correlationID string, short string, original string, submitted string, passwordHash string, userID int, expiresAt *time.Time) (string, error) {
 	select {
 	case <-ctx.Done():
 		return "", ctx.Err()
 	default:
 	}
-	s.links[short] = original
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if existing, found := s.duplicate(original, userID, ""); found && passwordHash == "" {
+		return existing, ErrURLAlreadyExists
+	}
+	if _, exist := s.links[short]; exist {
+		return "", ErrShortURLTaken
+	}
+	s.links[short] = &linkRecord{uuid: correlationID, original: original, submitted: submitted, password: passwordHash, userID: userID, expiresAt: expiresAt}
 	s.userLinks[userID] = append(s.userLinks[userID], short)
+	s.byOriginal[original] = append(s.byOriginal[original], short)
 	return short, nil
 }
 
-func (s *LinkStorage) Get(ctx context.Context, short string) (string, bool, error) {
+func (s *LinkStorage) Get(ctx context.Context, short string) (LinkInfo, bool, error) {
 	select {
 	case <-ctx.Done():
-		return "", false, ctx.Err()
+		return LinkInfo{}, false, ctx.Err()
 	default:
 	}
-	original, exists := s.links[short]
-	return original, exists, nil
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, exists := s.links[short]
+	if !exists {
+		return LinkInfo{}, false, nil
+	}
+	link := *record.info(short)
+	if record.deleted {
+		return link, true, ErrURLDeleted
+	}
+	if record.expired(time.Now()) {
+		return link, true, ErrURLExpired
+	}
+	return link, true, nil
+}
+
+// GetLinks возвращает сведения о найденных ссылках, включая удалённые и истёкшие.
+// Ненайденных кодов в результате нет.
+func (s *LinkStorage) GetLinks(ctx context.Context, shorts []string) (map[string]LinkInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make(map[string]LinkInfo, len(shorts))
+	for _, short := range shorts {
+		if record, exists := s.links[short]; exists {
+			links[short] = *record.info(short)
+		}
+	}
+	return links, nil
 }
 
 func (s *LinkStorage) Len(ctx context.Context) int {
@@ -43,6 +137,8 @@ func (s *LinkStorage) Len(ctx context.Context) int {
 		return 0
 	default:
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	return len(s.links)
 }
 
@@ -61,6 +157,8 @@ func (s *LinkStorage) SaveUser(ctx context.Context, userID int) error {
 		return nil
 	default:
 	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	s.users[userID] = true
 	s.userLinks[userID] = []string{}
 	return nil
@@ -72,6 +170,8 @@ func (s *LinkStorage) GetUserFromID(ctx context.Context, userID int) (bool, erro
 		return false, nil
 	default:
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	if _, exist := s.users[userID]; !exist {
 		return false, ErrUserNotFound
 	}
@@ -84,7 +184,15 @@ func (s *LinkStorage) GetNewUser(ctx context.Context) (int, error) {
 		return 0, nil
 	default:
 	}
-	NewIndexUser := len(s.users) + 1
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	// Идентификаторы могли прийти из другого хранилища с пропусками, поэтому берём максимум, а не количество
+	NewIndexUser := 1
+	for userID := range s.users {
+		if userID >= NewIndexUser {
+			NewIndexUser = userID + 1
+		}
+	}
 	return NewIndexUser, nil
 }
 
@@ -94,26 +202,330 @@ func (s *LinkStorage) GetLinksByUserID(ctx context.Context, userID int) (map[str
 		return nil, nil
 	default:
 	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	result := make(map[string]string)
 	if _, exist := s.userLinks[userID]; !exist {
 		return nil, ErrUserNotFound
 	}
+	now := time.Now()
 	for _, linkShort := range s.userLinks[userID] {
-		if _, exist := s.links[linkShort]; !exist {
+		record, exist := s.links[linkShort]
+		if !exist || record.deleted || record.expired(now) {
 			continue
 		}
-		original := s.links[linkShort]
-		result[linkShort] = original
+		result[linkShort] = record.display()
 	}
 	return result, nil
 }
 
-func (s *LinkStorage) AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]string, error) {
-	shortLinks := []string{}
+// AddLinksBatch сохраняет ссылки пакета по отдельности: занятый код не мешает остальным
+func (s *LinkStorage) AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]BatchResult, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]BatchResult, 0, len(links))
 	for _, link := range links {
 		shortLink := link.ShortLink
-		s.links[shortLink] = link.OriginalURL
-		shortLinks = append(shortLinks, shortLink)
+		result := BatchResult{CorrelationID: link.CorrelationID, ShortURL: shortLink, Status: BatchCreated}
+		if existing, found := s.duplicate(link.OriginalURL, userID, ""); found && link.PasswordHash == "" {
+			result.Status, result.ShortURL = BatchExists, existing
+			results = append(results, result)
+			continue
+		}
+		if _, exist := s.links[shortLink]; exist {
+			result.Status, result.Err = BatchError, ErrShortURLTaken
+			results = append(results, result)
+			continue
+		}
+		s.links[shortLink] = &linkRecord{uuid: link.CorrelationID, original: link.OriginalURL, submitted: link.SubmittedURL, password: link.PasswordHash, userID: userID, expiresAt: link.ExpiresAt}
+		s.userLinks[userID] = append(s.userLinks[userID], shortLink)
+		s.byOriginal[link.OriginalURL] = append(s.byOriginal[link.OriginalURL], shortLink)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (s *LinkStorage) DeleteUserLinks(ctx context.Context, requests []DeleteRequest) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, request := range requests {
+		for _, short := range request.ShortURLs {
+			record, exist := s.links[short]
+			// Удалять можно только свои ссылки
+			if !exist || record.userID != request.UserID {
+				continue
+			}
+			record.deleted = true
+		}
+	}
+	return nil
+}
+
+func (s *LinkStorage) GetLinkOwner(ctx context.Context, short string) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	record, exist := s.links[short]
+	if !exist {
+		return 0, ErrURLNotFound
+	}
+	return record.userID, nil
+}
+
+func (s *LinkStorage) SaveClicks(ctx context.Context, clicks []Click) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, click := range clicks {
+		s.clicks[click.ShortURL] = append(s.clicks[click.ShortURL], click)
+	}
+	return nil
+}
+
+func (s *LinkStorage) GetLinkStats(ctx context.Context, short string) (*LinkStats, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	visitors := map[string]bool{}
+	days := map[string]int{}
+	for _, click := range s.clicks[short] {
+		visitors[click.IPHash] = true
+		days[click.Time.UTC().Format(time.DateOnly)]++
+	}
+
+	stats := &LinkStats{TotalClicks: len(s.clicks[short]), UniqueVisitors: len(visitors), Daily: []DailyClicks{}}
+	for day, count := range days {
+		stats.Daily = append(stats.Daily, DailyClicks{Date: day, Clicks: count})
+	}
+	sort.Slice(stats.Daily, func(i, j int) bool { return stats.Daily[i].Date < stats.Daily[j].Date })
+	return stats, nil
+}
+
+func (s *LinkStorage) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	purged := 0
+	for short, record := range s.links {
+		if !record.expired(now) {
+			continue
+		}
+		delete(s.links, short)
+		delete(s.clicks, short)
+		delete(s.history, short)
+		s.userLinks[record.userID] = removeLink(s.userLinks[record.userID], short)
+		s.unindexOriginal(record.original, short)
+		purged++
+	}
+	return purged, nil
+}
+
+func (r *linkRecord) expired(now time.Time) bool {
+	return r.expiresAt != nil && !r.expiresAt.After(now)
+}
+
+func removeLink(links []string, short string) []string {
+	for i, link := range links {
+		if link == short {
+			return append(links[:i], links[i+1:]...)
+		}
+	}
+	return links
+}
+
+func (s *LinkStorage) unindexOriginal(original, short string) {
+	if shorts := removeLink(s.byOriginal[original], short); len(shorts) > 0 {
+		s.byOriginal[original] = shorts
+	} else {
+		delete(s.byOriginal, original)
+	}
+}
+
+func (s *LinkStorage) Update(ctx context.Context, short string, userID int, update LinkUpdate) (*LinkInfo, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record, exist := s.links[short]
+	if !exist || record.userID != userID {
+		return nil, ErrURLNotFound
+	}
+	if record.deleted {
+		return nil, ErrURLDeleted
+	}
+	if update.OriginalURL != nil && *update.OriginalURL != record.original {
+		if _, found := s.duplicate(*update.OriginalURL, userID, short); found && record.password == "" {
+			return nil, ErrURLAlreadyExists
+		}
+		s.history[short] = append(s.history[short], HistoryEntry{
+			Version:   len(s.history[short]) + 1,
+			OldURL:    record.original,
+			NewURL:    *update.OriginalURL,
+			UserID:    userID,
+			ChangedAt: time.Now(),
+		})
+		s.unindexOriginal(record.original, short)
+		s.byOriginal[*update.OriginalURL] = append(s.byOriginal[*update.OriginalURL], short)
+		record.original = *update.OriginalURL
+	}
+	if update.OriginalURL != nil {
+		record.submitted = ""
+		if update.SubmittedURL != nil {
+			record.submitted = *update.SubmittedURL
+		}
+	}
+	if update.Title != nil {
+		record.title = *update.Title
+	}
+	if update.ExpiresAt != nil {
+		record.expiresAt = update.ExpiresAt
+	}
+	return record.info(short), nil
+}
+
+func (s *LinkStorage) GetHistory(ctx context.Context, short string) ([]HistoryEntry, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := make([]HistoryEntry, len(s.history[short]))
+	copy(history, s.history[short])
+	return history, nil
+}
+
+// NextIDBlock выдаёт следующий номер блока идентификаторов из счётчика в памяти.
+// Сам он ничего не сохраняет: выданные блоки записывает в журнал обёртка IDBlocks,
+// а при восстановлении журнала ReserveIDBlock сдвигает счётчик за них.
+func (s *LinkStorage) NextIDBlock(ctx context.Context) (uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.idBlock++
+	return s.idBlock, nil
+}
+
+func (s *LinkStorage) ReserveIDBlock(ctx context.Context, hi uint64) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	default:
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if hi > s.idBlock {
+		s.idBlock = hi
+	}
+	return nil
+}
+
+func (s *LinkStorage) LastIDBlock(ctx context.Context) (uint64, error) {
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	default:
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.idBlock, nil
+}
+
+// ForEachLink обходит все ссылки, включая удалённые и истёкшие, в порядке коротких кодов
+func (s *LinkStorage) ForEachLink(ctx context.Context, fn func(LinkInfo) error) error {
+	s.mu.RLock()
+	links := make([]LinkInfo, 0, len(s.links))
+	for short, record := range s.links {
+		links = append(links, *record.info(short))
+	}
+	s.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortURL < links[j].ShortURL })
+	for _, link := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ForEachUser обходит всех пользователей в порядке идентификаторов
+func (s *LinkStorage) ForEachUser(ctx context.Context, fn func(userID int) error) error {
+	s.mu.RLock()
+	users := make([]int, 0, len(s.users))
+	for userID := range s.users {
+		users = append(users, userID)
+	}
+	s.mu.RUnlock()
+
+	sort.Ints(users)
+	for _, userID := range users {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *linkRecord) info(short string) *LinkInfo {
+	return &LinkInfo{
+		ShortURL:     short,
+		OriginalURL:  r.original,
+		SubmittedURL: r.submitted,
+		Title:        r.title,
+		ExpiresAt:    r.expiresAt,
+		UserID:       r.userID,
+		UUID:         r.uuid,
+		Deleted:      r.deleted,
+		PasswordHash: r.password,
+	}
+}
+
+// display — адрес для показа пользователю: присланный, если он отличался от канонического
+func (r *linkRecord) display() string {
+	if r.submitted != "" {
+		return r.submitted
 	}
-	return shortLinks, nil
+	return r.original
 }
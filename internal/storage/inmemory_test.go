@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReverseIndex(t *testing.T) {
+	ctx := context.Background()
+	s := NewLinkStorage()
+	const original = "https://example.com/reverse"
+
+	_, err := s.GetFromOriginal(ctx, original)
+	assert.ErrorIs(t, err, ErrURLNotFound)
+
+	_, err = s.Save(ctx, "1", "first", original, "", "", 1, nil)
+	require.NoError(t, err)
+	results, err := s.AddLinksBatch(ctx, []InfoAboutURL{{CorrelationID: "2", OriginalURL: original, ShortLink: "second"}}, 2)
+	require.NoError(t, err)
+	require.Equal(t, BatchCreated, results[0].Status)
+
+	short, err := s.GetFromOriginal(ctx, original)
+	require.NoError(t, err)
+	assert.Equal(t, "first", short)
+	assert.Equal(t, []string{"first", "second"}, shorts(t, s, original))
+
+	// Удалённая ссылка остаётся в индексе, но не подходит для GetFromOriginal
+	require.NoError(t, s.DeleteUserLinks(ctx, []DeleteRequest{{UserID: 1, ShortURLs: []string{"first"}}}))
+	short, err = s.GetFromOriginal(ctx, original)
+	require.NoError(t, err)
+	assert.Equal(t, "second", short)
+
+	moved := "https://example.com/moved"
+	_, err = s.Update(ctx, "second", 2, LinkUpdate{OriginalURL: &moved})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"first"}, shorts(t, s, original))
+	assert.Equal(t, []string{"second"}, shorts(t, s, moved))
+
+	expired := time.Now().Add(-time.Second)
+	_, err = s.Save(ctx, "3", "third", moved, "", "", 1, &expired)
+	require.NoError(t, err)
+	_, err = s.PurgeExpired(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"second"}, shorts(t, s, moved))
+}
+
+func shorts(t *testing.T, s *LinkStorage, original string) []string {
+	links, err := s.GetLinksByOriginal(context.Background(), original)
+	require.NoError(t, err)
+	result := make([]string, 0, len(links))
+	for _, link := range links {
+		assert.Equal(t, original, link.OriginalURL)
+		result = append(result, link.ShortURL)
+	}
+	return result
+}
+
+func TestDedupScope(t *testing.T) {
+	const original = "https://example.com/dedup"
+	tests := []struct {
+		scope     DedupScope
+		sameUser  error
+		otherUser error
+	}{
+		{DedupGlobal, ErrURLAlreadyExists, ErrURLAlreadyExists},
+		{DedupUser, ErrURLAlreadyExists, nil},
+		{DedupNone, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.scope), func(t *testing.T) {
+			ctx := context.Background()
+			s := NewLinkStorage()
+			require.NoError(t, s.SetDedupScope(ctx, tt.scope))
+
+			_, err := s.Save(ctx, "1", "first", original, "", "", 1, nil)
+			require.NoError(t, err)
+
+			short, err := s.Save(ctx, "2", "again", original, "", "", 1, nil)
+			assert.Equal(t, tt.sameUser, err)
+			if err != nil {
+				assert.Equal(t, "first", short)
+			}
+			_, err = s.Save(ctx, "3", "other", original, "", "", 2, nil)
+			assert.Equal(t, tt.otherUser, err)
+
+			// Пакет следует тем же правилам, включая повторы внутри пакета
+			results, err := s.AddLinksBatch(ctx, []InfoAboutURL{
+				{CorrelationID: "4", OriginalURL: original, ShortLink: "batch"},
+				{CorrelationID: "5", OriginalURL: "https://example.com/dedup-batch", ShortLink: "batch-1"},
+				{CorrelationID: "6", OriginalURL: "https://example.com/dedup-batch", ShortLink: "batch-2"},
+			}, 1)
+			require.NoError(t, err)
+			if tt.sameUser != nil {
+				assert.Equal(t, BatchResult{CorrelationID: "4", ShortURL: "first", Status: BatchExists}, results[0])
+				assert.Equal(t, BatchResult{CorrelationID: "6", ShortURL: "batch-1", Status: BatchExists}, results[2])
+			} else {
+				assert.Equal(t, BatchCreated, results[0].Status)
+				assert.Equal(t, BatchCreated, results[2].Status)
+			}
+
+			// Удалённая ссылка не мешает сократить адрес заново
+			require.NoError(t, s.DeleteUserLinks(ctx, []DeleteRequest{{UserID: 1, ShortURLs: []string{"first", "again", "batch"}}}))
+			_, err = s.Save(ctx, "7", "fresh", original, "", "", 1, nil)
+			assert.NoError(t, err)
+
+			moved := "https://example.com/dedup-batch"
+			_, err = s.Update(ctx, "fresh", 1, LinkUpdate{OriginalURL: &moved})
+			assert.Equal(t, tt.sameUser, err)
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MigrateOptions — параметры переноса данных между хранилищами
+type MigrateOptions struct {
+	// DryRun только проверяет перенос и ничего не пишет в целевое хранилище
+	DryRun bool
+	// After — последний перенесённый короткий код; ссылки до него включительно пропускаются
+	After string
+	// Journal получает записи перенесённых ссылок, если целевое хранилище — файловый журнал
+	Journal io.Writer
+	// Checkpoint вызывается с последним перенесённым кодом каждые CheckpointEvery ссылок и в конце
+	Checkpoint      func(short string) error
+	CheckpointEvery int
+}
+
+// MigrateConflict — ссылка, которую не удалось перенести без потери данных
+type MigrateConflict struct {
+	ShortURL    string
+	OriginalURL string
+	Reason      string
+}
+
+// MigrateReport — итог переноса
+type MigrateReport struct {
+	Users     int
+	Links     int
+	Skipped   int
+	Conflicts []MigrateConflict
+	Last      string
+}
+
+// Migrate переносит пользователей и ссылки из src в dst, сохраняя короткие коды,
+// UUID и владельцев. Ссылки обходятся по возрастанию коротких кодов в побайтовом порядке, поэтому прерванный
+// перенос можно продолжить с opts.After. Уже перенесённые ссылки пропускаются,
+// поэтому повторный запуск безопасен и без контрольной точки.
+func Migrate(ctx context.Context, src, dst Storage, opts MigrateOptions) (*MigrateReport, error) {
+	report := &MigrateReport{Last: opts.After}
+	users := map[int]bool{}
+
+	ensureUser := func(userID int) error {
+		if users[userID] {
+			return nil
+		}
+		users[userID] = true
+		if exists, _ := dst.GetUserFromID(ctx, userID); exists {
+			return nil
+		}
+		report.Users++
+		if opts.DryRun {
+			return nil
+		}
+		if err := dst.SaveUser(ctx, userID); err != nil {
+			return fmt.Errorf("ошибка переноса пользователя %d: %w", userID, err)
+		}
+		return nil
+	}
+
+	if err := src.ForEachUser(ctx, ensureUser); err != nil {
+		return report, err
+	}
+
+	var encoder *json.Encoder
+	if opts.Journal != nil && !opts.DryRun {
+		encoder = json.NewEncoder(opts.Journal)
+	}
+	// Счётчиковые стратегии продолжают нумерацию с блока после последнего выданного:
+	// без переноса счётчика новые коды совпали бы с перенесёнными
+	if err := migrateIDBlock(ctx, src, dst, opts.DryRun, encoder); err != nil {
+		return report, err
+	}
+
+	checkpoint := func() error {
+		if opts.Checkpoint == nil || opts.DryRun || report.Last == "" {
+			return nil
+		}
+		return opts.Checkpoint(report.Last)
+	}
+
+	sinceCheckpoint := 0
+	err := src.ForEachLink(ctx, func(link LinkInfo) error {
+		if opts.After != "" && link.ShortURL <= opts.After {
+			return nil
+		}
+
+		migrated, err := migrateLink(ctx, dst, link, opts.DryRun, ensureUser)
+		var conflict *MigrateConflict
+		if errors.As(err, &conflict) {
+			report.Conflicts = append(report.Conflicts, *conflict)
+		} else if err != nil {
+			return err
+		} else if migrated {
+			report.Links++
+			if encoder != nil {
+				for _, record := range journalRecords(link) {
+					if err := encoder.Encode(record); err != nil {
+						return fmt.Errorf("ошибка записи в журнал: %w", err)
+					}
+				}
+			}
+		} else {
+			report.Skipped++
+		}
+
+		report.Last = link.ShortURL
+		sinceCheckpoint++
+		if opts.CheckpointEvery > 0 && sinceCheckpoint >= opts.CheckpointEvery {
+			sinceCheckpoint = 0
+			return checkpoint()
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+	return report, checkpoint()
+}
+
+// migrateIDBlock сдвигает счётчик блоков идентификаторов dst за последний блок src
+func migrateIDBlock(ctx context.Context, src, dst Storage, dryRun bool, encoder *json.Encoder) error {
+	hi, err := src.LastIDBlock(ctx)
+	if err != nil {
+		return err
+	}
+	current, err := dst.LastIDBlock(ctx)
+	if err != nil {
+		return err
+	}
+	if hi <= current || dryRun {
+		return nil
+	}
+	if err := dst.ReserveIDBlock(ctx, hi); err != nil {
+		return fmt.Errorf("ошибка переноса блока идентификаторов: %w", err)
+	}
+	if encoder != nil {
+		if err := encoder.Encode(ShortenTextFile{IDBlock: &hi}); err != nil {
+			return fmt.Errorf("ошибка записи в журнал: %w", err)
+		}
+	}
+	return nil
+}
+
+// migrateLink переносит одну ссылку. false без ошибки — ссылка уже была перенесена.
+func migrateLink(ctx context.Context, dst Storage, link LinkInfo, dryRun bool, ensureUser func(int) error) (bool, error) {
+	// Get возвращает exists=true и для удалённых или истёкших ссылок
+	current, exists, _ := dst.Get(ctx, link.ShortURL)
+	if exists {
+		if current.OriginalURL == link.OriginalURL {
+			return false, nil
+		}
+		return false, &MigrateConflict{ShortURL: link.ShortURL, OriginalURL: link.OriginalURL,
+			Reason: "short code already points to " + current.OriginalURL}
+	}
+
+	if err := ensureUser(link.UserID); err != nil {
+		return false, err
+	}
+	if dryRun {
+		return true, nil
+	}
+
+	existing, err := dst.Save(ctx, link.UUID, link.ShortURL, link.OriginalURL, link.SubmittedURL, link.PasswordHash, link.UserID, link.ExpiresAt)
+	switch {
+	case errors.Is(err, ErrURLAlreadyExists):
+		return false, &MigrateConflict{ShortURL: link.ShortURL, OriginalURL: link.OriginalURL,
+			Reason: "original URL already shortened as " + existing}
+	case errors.Is(err, ErrShortURLTaken):
+		return false, &MigrateConflict{ShortURL: link.ShortURL, OriginalURL: link.OriginalURL,
+			Reason: "short code already taken"}
+	case errors.Is(err, ErrUUIDTaken):
+		return false, &MigrateConflict{ShortURL: link.ShortURL, OriginalURL: link.OriginalURL,
+			Reason: "UUID " + link.UUID + " already used"}
+	case err != nil:
+		return false, fmt.Errorf("ошибка переноса ссылки %s: %w", link.ShortURL, err)
+	}
+
+	if link.Title != "" {
+		title := link.Title
+		if _, err := dst.Update(ctx, link.ShortURL, link.UserID, LinkUpdate{Title: &title}); err != nil {
+			return false, fmt.Errorf("ошибка переноса заголовка %s: %w", link.ShortURL, err)
+		}
+	}
+	if link.Deleted {
+		err := dst.DeleteUserLinks(ctx, []DeleteRequest{{UserID: link.UserID, ShortURLs: []string{link.ShortURL}}})
+		if err != nil {
+			return false, fmt.Errorf("ошибка переноса удаления %s: %w", link.ShortURL, err)
+		}
+	}
+	return true, nil
+}
+
+func (c *MigrateConflict) Error() string {
+	return c.ShortURL + ": " + c.Reason
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrateResumeMixedCase(t *testing.T) {
+	ctx := context.Background()
+	src := NewLinkStorage()
+	// В побайтовом порядке заглавные буквы идут раньше строчных: C, a, b, c
+	for _, short := range []string{"a", "b", "C", "c"} {
+		_, err := src.Save(ctx, short, short, "https://example.com/"+short, "", "", 1, nil)
+		require.NoError(t, err)
+	}
+
+	dst := NewLinkStorage()
+	errInterrupted := errors.New("перенос прерван")
+	var checkpoint string
+	_, err := Migrate(ctx, src, dst, MigrateOptions{
+		CheckpointEvery: 1,
+		Checkpoint: func(short string) error {
+			checkpoint = short
+			if short == "a" {
+				return errInterrupted
+			}
+			return nil
+		},
+	})
+	require.ErrorIs(t, err, errInterrupted)
+	require.Equal(t, "a", checkpoint)
+
+	report, err := Migrate(ctx, src, dst, MigrateOptions{After: checkpoint})
+	require.NoError(t, err)
+	assert.Equal(t, 2, report.Links)
+	assert.Equal(t, 0, report.Skipped)
+	for _, short := range []string{"a", "b", "C", "c"} {
+		link, found, err := dst.Get(ctx, short)
+		require.NoError(t, err)
+		require.True(t, found, short)
+		assert.Equal(t, "https://example.com/"+short, link.OriginalURL)
+	}
+}
+
+func TestMigrateIDBlocks(t *testing.T) {
+	ctx := context.Background()
+	src := NewLinkStorage()
+	for i := 0; i < 3; i++ {
+		_, err := src.NextIDBlock(ctx)
+		require.NoError(t, err)
+	}
+	_, err := src.Save(ctx, "1", "seq", "https://example.com/seq", "", "", 1, nil)
+	require.NoError(t, err)
+
+	dst := NewLinkStorage()
+	var journal bytes.Buffer
+	_, err = Migrate(ctx, src, dst, MigrateOptions{Journal: &journal})
+	require.NoError(t, err)
+	// Блоки, выданные исходному хранилищу, целевое больше не выдаёт
+	hi, err := dst.NextIDBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), hi)
+
+	// Повторный перенос не дописывает в журнал уже перенесённый блок
+	_, err = Migrate(ctx, src, dst, MigrateOptions{Journal: &journal})
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(journal.String(), `"id_block"`))
+
+	// Целевой журнал тоже помнит блоки
+	restored := NewLinkStorage()
+	require.NoError(t, ReplayLinks(ctx, restored, &journal, nil))
+	hi, err = restored.NextIDBlock(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), hi)
+}
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS urls;
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS users (
+	id SERIAL PRIMARY KEY,
+	user_id INT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS urls (
+	id SERIAL PRIMARY KEY,
+	correlation_id TEXT UNIQUE NOT NULL,
+	short_url TEXT UNIQUE NOT NULL,
+	original_url TEXT UNIQUE NOT NULL,
+	user_id INT NOT NULL,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS url_history;
+ALTER TABLE urls DROP COLUMN IF EXISTS title;
@@ -0,0 +1,12 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS url_history (
+	id BIGSERIAL PRIMARY KEY,
+	short_url TEXT NOT NULL,
+	version INT NOT NULL,
+	old_url TEXT NOT NULL,
+	new_url TEXT NOT NULL,
+	user_id INT NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	UNIQUE (short_url, version)
+);
@@ -0,0 +1 @@
+DROP SEQUENCE IF EXISTS short_url_block_seq;
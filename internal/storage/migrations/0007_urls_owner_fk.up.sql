@@ -0,0 +1,3 @@
+-- Ссылки принадлежат пользователю по user_id из JWT, а не по суррогатному id
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_user_id_fkey;
+ALTER TABLE urls ADD CONSTRAINT urls_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(user_id) ON DELETE CASCADE;
@@ -0,0 +1,6 @@
+-- Откат не пройдёт, если уже есть несколько ссылок на один адрес
+DROP INDEX IF EXISTS urls_original_url_idx;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_dedup_key_key;
+ALTER TABLE urls DROP COLUMN IF EXISTS dedup_key;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+ALTER TABLE urls ADD CONSTRAINT urls_original_url_key UNIQUE (original_url);
@@ -0,0 +1,8 @@
+-- Уникальность адреса задаётся ключом дедупликации, который вычисляет приложение по настроенной области.
+-- До этой миграции адрес был уникален глобально, поэтому ключом становится сам адрес.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS dedup_key TEXT;
+UPDATE urls SET dedup_key = original_url WHERE dedup_key IS NULL AND NOT is_deleted;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_original_url_key;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_dedup_key_key;
+ALTER TABLE urls ADD CONSTRAINT urls_dedup_key_key UNIQUE (dedup_key);
+CREATE INDEX IF NOT EXISTS urls_original_url_idx ON urls (original_url);
@@ -0,0 +1,2 @@
+-- Адрес в том виде, в каком его прислал пользователь, если канонизация его изменила
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS submitted_url TEXT;
@@ -0,0 +1,2 @@
+-- Хеш пароля bcrypt для защищённых ссылок
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS password_hash TEXT;
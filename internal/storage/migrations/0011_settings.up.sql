@@ -0,0 +1,6 @@
+-- Настройки, общие для всех реплик. dedup_scope — область, под которую сейчас вычислены ключи дедупликации:
+-- пока она не меняется, запуск сервера не пересчитывает ключи.
+CREATE TABLE IF NOT EXISTS settings (
+	name TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
@@ -2,68 +2,189 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
-	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// getURLStatement — подготовленный запрос горячего пути редиректа
+const (
+	getURLStatement = "get_url"
+	getURLQuery     = "SELECT original_url, is_deleted, expires_at, COALESCE(password_hash, '') FROM urls WHERE short_url = $1"
 )
 
-func NewPostgresStorage(dsn string) (*PostgresStorage, error) {
-	db, err := sql.Open("pgx", dsn)
+// PoolConfig — настройки пула соединений, нулевые значения оставляют умолчания pgxpool
+type PoolConfig struct {
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	MaxConnIdleTime time.Duration
+	ConnectTimeout  time.Duration
+}
+
+// NewPostgresStorage подключается к БД и применяет недостающие миграции схемы
+func NewPostgresStorage(ctx context.Context, dsn string, poolConfig PoolConfig) (*PostgresStorage, error) {
+	storage, err := OpenPostgresStorage(ctx, dsn, poolConfig)
 	if err != nil {
 		return nil, err
 	}
 
-	storage := &PostgresStorage{db: db}
+	if _, err := storage.MigrateUp(ctx, 0); err != nil {
+		storage.Close()
+		return nil, err
+	}
+
+	return storage, nil
+}
 
-	err = storage.createSchema()
+// OpenPostgresStorage создаёт пул соединений, не трогая схему
+func OpenPostgresStorage(ctx context.Context, dsn string, poolConfig PoolConfig) (*PostgresStorage, error) {
+	config, err := pgxpool.ParseConfig(dsn)
 	if err != nil {
 		return nil, err
 	}
+	if poolConfig.MaxConns > 0 {
+		config.MaxConns = poolConfig.MaxConns
+	}
+	if poolConfig.MinConns > 0 {
+		config.MinConns = poolConfig.MinConns
+	}
+	if poolConfig.MaxConnLifetime > 0 {
+		config.MaxConnLifetime = poolConfig.MaxConnLifetime
+	}
+	if poolConfig.MaxConnIdleTime > 0 {
+		config.MaxConnIdleTime = poolConfig.MaxConnIdleTime
+	}
+	if poolConfig.ConnectTimeout > 0 {
+		config.ConnConfig.ConnectTimeout = poolConfig.ConnectTimeout
+	}
 
-	return storage, nil
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresStorage{pool: pool, dedup: DedupGlobal}, nil
 }
 
-func (s *PostgresStorage) createSchema() error {
-	query := `
-	CREATE TABLE IF NOT EXISTS users (
-		id SERIAL PRIMARY KEY,
-		user_id INT UNIQUE NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS urls (
-		id SERIAL PRIMARY KEY,
-		correlation_id TEXT UNIQUE NOT NULL,
-		short_url TEXT UNIQUE NOT NULL,
-		original_url TEXT UNIQUE NOT NULL,
-		user_id INT NOT NULL,
-		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
-	);
-    `
-	_, err := s.db.Exec(query)
-	return err
+// dedupScopeSetting — строка settings с областью, под которую вычислены ключи дедупликации
+const dedupScopeSetting = "dedup_scope"
+
+// SetDedupScope пересчитывает ключи дедупликации ссылок под новую область.
+// Если ссылок на адрес в новой области несколько, ключ получает самая ранняя, остальные остаются без ключа.
+// Применённая область хранится в settings: если она не изменилась, ключи не пересчитываются и таблица не блокируется.
+func (s *PostgresStorage) SetDedupScope(ctx context.Context, scope DedupScope) error {
+	if current, err := storedDedupScope(ctx, s.pool); err != nil {
+		return err
+	} else if current == scope {
+		s.dedup = scope
+		return nil
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Новые ссылки во время пересчёта получили бы ключ старой области
+	if _, err := tx.Exec(ctx, "LOCK TABLE urls IN SHARE ROW EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+	// Другая реплика могла пересчитать ключи, пока мы ждали блокировку
+	current, err := storedDedupScope(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if current != scope {
+		if err := rewriteDedupKeys(ctx, tx, scope); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+	s.dedup = scope
+	return nil
+}
+
+// rowQuerier — общее у пула и транзакции
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// storedDedupScope возвращает область из settings, пустую — если ключи ещё ни разу не пересчитывались
+func storedDedupScope(ctx context.Context, q rowQuerier) (DedupScope, error) {
+	var scope string
+	err := q.QueryRow(ctx, "SELECT value FROM settings WHERE name = $1", dedupScopeSetting).Scan(&scope)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка чтения области дедупликации: %w", err)
+	}
+	return DedupScope(scope), nil
+}
+
+func rewriteDedupKeys(ctx context.Context, tx pgx.Tx, scope DedupScope) error {
+	keyed := `WITH keyed AS (
+             SELECT id, CASE WHEN row_number() OVER (PARTITION BY key ORDER BY id) = 1 THEN key END AS key
+             FROM (SELECT id, ` + scope.keySQL() + ` AS key FROM urls) k
+         )`
+	// Сначала снимаем устаревшие ключи, чтобы перестановка ключей между строками не нарушила уникальность
+	_, err := tx.Exec(ctx, keyed+` UPDATE urls SET dedup_key = NULL FROM keyed
+         WHERE urls.id = keyed.id AND urls.dedup_key IS DISTINCT FROM keyed.key`)
+	if err != nil {
+		return fmt.Errorf("ошибка сброса ключей дедупликации: %w", err)
+	}
+	_, err = tx.Exec(ctx, keyed+` UPDATE urls SET dedup_key = keyed.key FROM keyed
+         WHERE urls.id = keyed.id AND urls.dedup_key IS DISTINCT FROM keyed.key`)
+	if err != nil {
+		return fmt.Errorf("ошибка пересчёта ключей дедупликации: %w", err)
+	}
+	_, err = tx.Exec(ctx, `INSERT INTO settings (name, value) VALUES ($1, $2)
+         ON CONFLICT (name) DO UPDATE SET value = EXCLUDED.value`, dedupScopeSetting, string(scope))
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения области дедупликации: %w", err)
+	}
+	return nil
+}
+
+// Close закрывает все соединения пула
+func (s *PostgresStorage) Close() {
+	s.pool.Close()
 }
 
-func (s *PostgresStorage) Save(ctx context.Context, correlationID string, short string, original string, userID int) (string, error) {
+func (s *PostgresStorage) Save(ctx context.Context, correlationID string, short string, original string, submitted string, passwordHash string, userID int, expiresAt *time.Time) (string, error) {
 	var existingShortURL string
+	dedupKey := s.dedupKey(userID, original, passwordHash)
 
-	err := s.db.QueryRow(
-		`INSERT INTO urls (correlation_id, short_url, original_url, user_id) 
-         VALUES ($1, $2, $3, $4) 
-         ON CONFLICT (original_url) DO NOTHING 
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO urls (correlation_id, short_url, original_url, user_id, expires_at, dedup_key, submitted_url, password_hash) 
+         VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, '')) 
+         ON CONFLICT (dedup_key) DO NOTHING 
          RETURNING short_url`,
-		correlationID, short, original, userID,
+		correlationID, short, original, userID, expiresAt, dedupKey, submitted, passwordHash,
 	).Scan(&existingShortURL)
 
-	// Если в `existingShortURL` пусто — значит, запись уже была, и нам нужно ее найти
-	if errors.Is(err, sql.ErrNoRows) || existingShortURL == "" {
-		existingShortURL, dbErr := s.GetFromOriginal(ctx, original)
+	if isShortURLConflict(err) {
+		return "", ErrShortURLTaken
+	}
+	if isUniqueViolation(err, "urls_correlation_id_key") {
+		return "", ErrUUIDTaken
+	}
+
+	// Если строка не вернулась — значит, запись с тем же ключом дедупликации уже была, и нам нужно ее найти
+	if errors.Is(err, pgx.ErrNoRows) {
+		dbErr := s.pool.QueryRow(ctx, "SELECT short_url FROM urls WHERE dedup_key = $1", dedupKey).Scan(&existingShortURL)
 		if dbErr != nil {
 			return "", fmt.Errorf("ошибка получения существующего URL: %w", dbErr)
 		}
 		return existingShortURL, ErrURLAlreadyExists
 	}
-
 	if err != nil {
 		return "", fmt.Errorf("ошибка сохранения в БД: %w", err)
 	}
@@ -71,28 +192,69 @@ func (s *PostgresStorage) Save(ctx context.Context, correlationID string, short
 	return existingShortURL, nil
 }
 
-func (s *PostgresStorage) Get(ctx context.Context, shortURL string) (string, bool, error) {
-	var originalURL string
-	err := s.db.QueryRowContext(ctx, "SELECT original_url FROM urls WHERE short_url=$1", shortURL).Scan(&originalURL)
+// dedupKey — ключ дедупликации новой ссылки, ссылки с паролем в дедупликации не участвуют
+func (s *PostgresStorage) dedupKey(userID int, original string, passwordHash string) *string {
+	if passwordHash != "" {
+		return nil
+	}
+	return s.dedup.key(userID, original)
+}
+
+// Get выполняет подготовленный запрос: Prepare на уже подготовившем его соединении не ходит в БД
+func (s *PostgresStorage) Get(ctx context.Context, shortURL string) (LinkInfo, bool, error) {
+	conn, err := s.pool.Acquire(ctx)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return "", false, errors.New("url not found")
+		return LinkInfo{}, false, err
+	}
+	defer conn.Release()
+	if _, err := conn.Conn().Prepare(ctx, getURLStatement, getURLQuery); err != nil {
+		return LinkInfo{}, false, err
+	}
+
+	link := LinkInfo{ShortURL: shortURL}
+	err = conn.QueryRow(ctx, getURLStatement, shortURL).Scan(&link.OriginalURL, &link.Deleted, &link.ExpiresAt, &link.PasswordHash)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return LinkInfo{}, false, nil
 		}
-		return "", false, err
+		return LinkInfo{}, false, err
+	}
+	if link.Deleted {
+		return link, true, ErrURLDeleted
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		return link, true, ErrURLExpired
+	}
+	return link, true, nil
+}
+
+// GetLinks достаёт ссылки одним запросом, включая удалённые и истёкшие
+func (s *PostgresStorage) GetLinks(ctx context.Context, shorts []string) (map[string]LinkInfo, error) {
+	rows, err := s.pool.Query(ctx, `SELECT short_url, original_url, COALESCE(submitted_url, ''), title, expires_at, user_id, correlation_id, is_deleted, COALESCE(password_hash, '')
+         FROM urls WHERE short_url = ANY($1)`, shorts)
+	if err != nil {
+		return nil, err
 	}
-	if originalURL == "" {
-		return "", false, err
+	defer rows.Close()
+
+	links := make(map[string]LinkInfo, len(shorts))
+	for rows.Next() {
+		var link LinkInfo
+		if err := rows.Scan(&link.ShortURL, &link.OriginalURL, &link.SubmittedURL, &link.Title, &link.ExpiresAt, &link.UserID, &link.UUID, &link.Deleted, &link.PasswordHash); err != nil {
+			return nil, err
+		}
+		links[link.ShortURL] = link
 	}
-	return originalURL, true, nil
+	return links, rows.Err()
 }
 
 func (s *PostgresStorage) Ping(ctx context.Context) error {
-	return s.db.PingContext(ctx)
+	return s.pool.Ping(ctx)
 }
 
 func (s *PostgresStorage) Len(ctx context.Context) int {
 	var count int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM urls").Scan(&count)
+	err := s.pool.QueryRow(ctx, "SELECT COUNT(*) FROM urls").Scan(&count)
 	if err != nil {
 		return 0
 	}
@@ -101,25 +263,43 @@ func (s *PostgresStorage) Len(ctx context.Context) int {
 
 func (s *PostgresStorage) GetFromOriginal(ctx context.Context, originalURL string) (string, error) {
 	var shorten string
-	err := s.db.QueryRowContext(ctx, "SELECT short_url FROM urls WHERE original_url=$1", originalURL).Scan(&shorten)
-
+	err := s.pool.QueryRow(ctx, "SELECT short_url FROM urls WHERE original_url = $1 AND NOT is_deleted ORDER BY id LIMIT 1", originalURL).Scan(&shorten)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", ErrURLNotFound
+	}
 	if err != nil {
 		return "", err
 	}
-	link := shorten
-	return link, nil
+	return shorten, nil
 }
 
-func (s *PostgresStorage) SaveUser(ctx context.Context, userID int) error {
-	err := s.db.QueryRowContext(ctx, "INSERT INTO users (user_id) VALUES ($1)", userID)
+// GetLinksByOriginal возвращает все ссылки на адрес в порядке создания, включая удалённые и истёкшие
+func (s *PostgresStorage) GetLinksByOriginal(ctx context.Context, originalURL string) ([]LinkInfo, error) {
+	rows, err := s.pool.Query(ctx, `SELECT short_url, original_url, COALESCE(submitted_url, ''), title, expires_at, user_id, correlation_id, is_deleted, COALESCE(password_hash, '')
+         FROM urls WHERE original_url = $1 ORDER BY id`, originalURL)
 	if err != nil {
-		return err.Err()
+		return nil, err
 	}
-	return nil
+	defer rows.Close()
+
+	var links []LinkInfo
+	for rows.Next() {
+		var link LinkInfo
+		if err := rows.Scan(&link.ShortURL, &link.OriginalURL, &link.SubmittedURL, &link.Title, &link.ExpiresAt, &link.UserID, &link.UUID, &link.Deleted, &link.PasswordHash); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+func (s *PostgresStorage) SaveUser(ctx context.Context, userID int) error {
+	_, err := s.pool.Exec(ctx, "INSERT INTO users (user_id) VALUES ($1)", userID)
+	return err
 }
 
 func (s *PostgresStorage) GetUserFromID(ctx context.Context, userID int) (bool, error) {
-	err := s.db.QueryRowContext(ctx, "SELECT id FROM users WHERE user_id = $1", userID).Scan(&userID)
+	err := s.pool.QueryRow(ctx, "SELECT id FROM users WHERE user_id = $1", userID).Scan(&userID)
 	if err != nil {
 		return false, err
 	}
@@ -127,16 +307,17 @@ func (s *PostgresStorage) GetUserFromID(ctx context.Context, userID int) (bool,
 }
 
 func (s *PostgresStorage) GetNewUser(ctx context.Context) (int, error) {
-	var countUsers int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(user_id) FROM users").Scan(&countUsers)
+	var maxUserID int
+	err := s.pool.QueryRow(ctx, "SELECT COALESCE(MAX(user_id), 0) FROM users").Scan(&maxUserID)
 	if err != nil {
 		return 0, err
 	}
-	return countUsers + 1, nil
+	return maxUserID + 1, nil
 }
 
 func (s *PostgresStorage) GetLinksByUserID(ctx context.Context, userID int) (map[string]string, error) {
-	rows, err := s.db.QueryContext(ctx, "SELECT short_url, original_url FROM urls WHERE user_id = $1", userID)
+	rows, err := s.pool.Query(ctx, `SELECT short_url, COALESCE(submitted_url, original_url) FROM urls
+         WHERE user_id = $1 AND NOT is_deleted AND (expires_at IS NULL OR expires_at > now())`, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -158,50 +339,387 @@ func (s *PostgresStorage) GetLinksByUserID(ctx context.Context, userID int) (map
 
 	return links, nil
 }
-func (s *PostgresStorage) AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]string, error) {
-	tx, err := s.db.Begin()
+
+// AddLinksBatch копирует пакет через COPY во временную таблицу и переносит в urls
+// одним INSERT ... ON CONFLICT, поэтому размер пакета не упирается в лимит параметров.
+// Конфликт одной ссылки не прерывает пакет: её исход определяется по тому, что уже есть в urls.
+func (s *PostgresStorage) AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]BatchResult, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `CREATE TEMP TABLE batch_links (
+		position INT NOT NULL,
+		correlation_id TEXT NOT NULL,
+		short_url TEXT NOT NULL,
+		original_url TEXT NOT NULL,
+		expires_at TIMESTAMPTZ,
+		dedup_key TEXT,
+		submitted_url TEXT,
+		password_hash TEXT
+	) ON COMMIT DROP`)
 	if err != nil {
+		return nil, fmt.Errorf("ошибка создания временной таблицы: %w", err)
+	}
+
+	_, err = tx.CopyFrom(ctx,
+		pgx.Identifier{"batch_links"},
+		[]string{"position", "correlation_id", "short_url", "original_url", "expires_at", "dedup_key", "submitted_url", "password_hash"},
+		pgx.CopyFromSlice(len(links), func(i int) ([]any, error) {
+			link := links[i]
+			return []any{i, link.CorrelationID, link.ShortLink, link.OriginalURL, link.ExpiresAt, s.dedupKey(userID, link.OriginalURL, link.PasswordHash), link.SubmittedURL, link.PasswordHash}, nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка копирования пакета: %w", err)
+	}
+
+	// urls внутри запроса видна без только что вставленных строк, поэтому u — ранее сохранённые ссылки.
+	// Повтор ключа дедупликации внутри пакета получает ссылку первого вхождения.
+	rows, err := tx.Query(ctx,
+		`WITH inserted AS (
+             INSERT INTO urls (correlation_id, short_url, original_url, user_id, expires_at, dedup_key, submitted_url, password_hash)
+             SELECT correlation_id, short_url, original_url, $1, expires_at, dedup_key, NULLIF(submitted_url, ''), NULLIF(password_hash, '')
+             FROM batch_links ORDER BY position
+             ON CONFLICT DO NOTHING
+             RETURNING correlation_id, short_url, dedup_key
+         )
+         SELECT b.correlation_id, b.short_url,
+             EXISTS (SELECT 1 FROM inserted WHERE correlation_id = b.correlation_id AND short_url = b.short_url),
+             (SELECT short_url FROM inserted WHERE dedup_key = b.dedup_key),
+             u.short_url,
+             EXISTS (SELECT 1 FROM urls WHERE short_url = b.short_url)
+                 OR EXISTS (SELECT 1 FROM inserted WHERE short_url = b.short_url AND correlation_id <> b.correlation_id)
+         FROM batch_links b
+         LEFT JOIN urls u ON u.dedup_key = b.dedup_key
+         ORDER BY b.position`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка сохранения пакета: %w", err)
+	}
+	defer rows.Close()
+
+	results := make([]BatchResult, 0, len(links))
+	for rows.Next() {
+		var result BatchResult
+		var insertedShort, existingShort *string
+		var created, shortTaken bool
+		if err := rows.Scan(&result.CorrelationID, &result.ShortURL, &created, &insertedShort, &existingShort, &shortTaken); err != nil {
+			return nil, err
+		}
+		switch {
+		case created:
+			result.Status = BatchCreated
+		case insertedShort != nil:
+			result.Status, result.ShortURL = BatchExists, *insertedShort
+		case existingShort != nil:
+			result.Status, result.ShortURL = BatchExists, *existingShort
+		case shortTaken:
+			result.Status, result.Err = BatchError, ErrShortURLTaken
+		default:
+			result.Status, result.Err = BatchError, ErrUUIDTaken
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения пакета: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+	return results, nil
+}
 
-	values := []interface{}{}
-	placeholders := []string{}
+// DeleteUserLinks помечает ссылки удалёнными одним UPDATE на весь накопленный пакет.
+// Ссылка удаляется только если она принадлежит пользователю из запроса.
+func (s *PostgresStorage) DeleteUserLinks(ctx context.Context, requests []DeleteRequest) error {
+	shortURLs := []string{}
+	userIDs := []int{}
+	for _, request := range requests {
+		for _, short := range request.ShortURLs {
+			shortURLs = append(shortURLs, short)
+			userIDs = append(userIDs, request.UserID)
+		}
+	}
+	if len(shortURLs) == 0 {
+		return nil
+	}
 
-	for i, link := range links {
-		shortLink := link.ShortLink
+	_, err := s.pool.Exec(ctx,
+		`UPDATE urls SET is_deleted = TRUE, dedup_key = NULL
+         FROM unnest($1::text[], $2::int[]) AS d(short_url, user_id)
+         WHERE urls.short_url = d.short_url AND urls.user_id = d.user_id`,
+		shortURLs, userIDs,
+	)
+	if err != nil {
+		return fmt.Errorf("ошибка удаления ссылок: %w", err)
+	}
+	return nil
+}
 
-		values = append(values, link.CorrelationID, shortLink, link.OriginalURL, userID)
-		placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d)", i*4+1, i*4+2, i*4+3, i*4+4))
+func (s *PostgresStorage) GetLinkOwner(ctx context.Context, short string) (int, error) {
+	var userID int
+	err := s.pool.QueryRow(ctx, "SELECT user_id FROM urls WHERE short_url = $1", short).Scan(&userID)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrURLNotFound
+		}
+		return 0, err
 	}
+	return userID, nil
+}
 
-	query := fmt.Sprintf(
-		"INSERT INTO urls (correlation_id, short_url, original_url, user_id) VALUES %s RETURNING short_url",
-		strings.Join(placeholders, ","),
+// SaveClicks записывает накопленные переходы одним INSERT
+func (s *PostgresStorage) SaveClicks(ctx context.Context, clicks []Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+	shortURLs := make([]string, 0, len(clicks))
+	times := make([]time.Time, 0, len(clicks))
+	referrers := make([]string, 0, len(clicks))
+	userAgents := make([]string, 0, len(clicks))
+	ipHashes := make([]string, 0, len(clicks))
+	for _, click := range clicks {
+		shortURLs = append(shortURLs, click.ShortURL)
+		times = append(times, click.Time)
+		referrers = append(referrers, click.Referrer)
+		userAgents = append(userAgents, click.UserAgent)
+		ipHashes = append(ipHashes, click.IPHash)
+	}
+
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO clicks (short_url, clicked_at, referrer, user_agent, ip_hash)
+         SELECT * FROM unnest($1::text[], $2::timestamptz[], $3::text[], $4::text[], $5::text[])`,
+		shortURLs, times, referrers, userAgents, ipHashes,
 	)
+	if err != nil {
+		return fmt.Errorf("ошибка сохранения переходов: %w", err)
+	}
+	return nil
+}
 
-	rows, err := tx.QueryContext(ctx, query, values...)
+func (s *PostgresStorage) GetLinkStats(ctx context.Context, short string) (*LinkStats, error) {
+	stats := &LinkStats{Daily: []DailyClicks{}}
+	err := s.pool.QueryRow(ctx,
+		"SELECT COUNT(*), COUNT(DISTINCT ip_hash) FROM clicks WHERE short_url = $1", short,
+	).Scan(&stats.TotalClicks, &stats.UniqueVisitors)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT to_char(clicked_at AT TIME ZONE 'UTC', 'YYYY-MM-DD') AS day, COUNT(*)
+         FROM clicks WHERE short_url = $1
+         GROUP BY day ORDER BY day`, short)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var results []string
 	for rows.Next() {
-		var shortURL string
-		if err := rows.Scan(&shortURL); err != nil {
+		var day DailyClicks
+		if err := rows.Scan(&day.Date, &day.Clicks); err != nil {
 			return nil, err
 		}
-		results = append(results, shortURL)
+		stats.Daily = append(stats.Daily, day)
 	}
-
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
 
-	if err := tx.Commit(); err != nil {
+	return stats, nil
+}
+
+// PurgeExpired физически удаляет истёкшие ссылки вместе с их статистикой и историей
+func (s *PostgresStorage) PurgeExpired(ctx context.Context, now time.Time) (int, error) {
+	var purged int
+	err := s.pool.QueryRow(ctx,
+		`WITH purged AS (
+             DELETE FROM urls WHERE expires_at IS NOT NULL AND expires_at <= $1 RETURNING short_url
+         ), purged_clicks AS (
+             DELETE FROM clicks WHERE short_url IN (SELECT short_url FROM purged)
+         ), purged_history AS (
+             DELETE FROM url_history WHERE short_url IN (SELECT short_url FROM purged)
+         )
+         SELECT COUNT(*) FROM purged`, now,
+	).Scan(&purged)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка удаления истёкших ссылок: %w", err)
+	}
+	return purged, nil
+}
+
+// Update меняет ссылку, только если она принадлежит пользователю и не удалена.
+// Смена адреса назначения записывается в url_history в той же транзакции.
+func (s *PostgresStorage) Update(ctx context.Context, short string, userID int, update LinkUpdate) (*LinkInfo, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var oldURL string
+	var isDeleted bool
+	err = tx.QueryRow(ctx,
+		"SELECT original_url, is_deleted FROM urls WHERE short_url = $1 AND user_id = $2 FOR UPDATE", short, userID,
+	).Scan(&oldURL, &isDeleted)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrURLNotFound
+	}
+	if err != nil {
 		return nil, err
 	}
+	if isDeleted {
+		return nil, ErrURLDeleted
+	}
 
-	return results, nil
+	newURL := oldURL
+	if update.OriginalURL != nil {
+		newURL = *update.OriginalURL
+	}
+
+	info := &LinkInfo{}
+	err = tx.QueryRow(ctx,
+		`UPDATE urls SET
+             original_url = $2,
+             title = COALESCE($3, title),
+             expires_at = COALESCE($4, expires_at),
+             dedup_key = CASE WHEN original_url = $2 OR password_hash IS NOT NULL THEN dedup_key ELSE $5 END,
+             submitted_url = CASE WHEN $6 THEN $7 ELSE submitted_url END
+         WHERE short_url = $1
+         RETURNING short_url, original_url, COALESCE(submitted_url, ''), title, expires_at, user_id, COALESCE(password_hash, '')`,
+		short, newURL, update.Title, update.ExpiresAt, s.dedup.key(userID, newURL), update.OriginalURL != nil, update.SubmittedURL,
+	).Scan(&info.ShortURL, &info.OriginalURL, &info.SubmittedURL, &info.Title, &info.ExpiresAt, &info.UserID, &info.PasswordHash)
+	if isUniqueViolation(err, "urls_dedup_key_key") {
+		return nil, ErrURLAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ошибка обновления ссылки: %w", err)
+	}
+	if info.OriginalURL != oldURL {
+		_, err = tx.Exec(ctx,
+			`INSERT INTO url_history (short_url, version, old_url, new_url, user_id)
+             VALUES ($1, (SELECT COALESCE(MAX(version), 0) + 1 FROM url_history WHERE short_url = $1), $2, $3, $4)`,
+			short, oldURL, info.OriginalURL, userID,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка записи истории: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (s *PostgresStorage) GetHistory(ctx context.Context, short string) ([]HistoryEntry, error) {
+	rows, err := s.pool.Query(ctx,
+		`SELECT version, old_url, new_url, user_id, changed_at FROM url_history
+         WHERE short_url = $1 ORDER BY version`, short)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := []HistoryEntry{}
+	for rows.Next() {
+		var entry HistoryEntry
+		if err := rows.Scan(&entry.Version, &entry.OldURL, &entry.NewURL, &entry.UserID, &entry.ChangedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+// NextIDBlock выдаёт номер блока идентификаторов из общей для всех реплик последовательности
+func (s *PostgresStorage) NextIDBlock(ctx context.Context) (uint64, error) {
+	var hi int64
+	if err := s.pool.QueryRow(ctx, "SELECT nextval('short_url_block_seq')").Scan(&hi); err != nil {
+		return 0, fmt.Errorf("ошибка получения блока идентификаторов: %w", err)
+	}
+	return uint64(hi), nil
+}
+
+// ReserveIDBlock сдвигает последовательность так, чтобы блок hi и предыдущие больше не выдавались
+func (s *PostgresStorage) ReserveIDBlock(ctx context.Context, hi uint64) error {
+	_, err := s.pool.Exec(ctx,
+		`SELECT setval('short_url_block_seq', GREATEST($1, (SELECT last_value FROM short_url_block_seq)))`,
+		int64(hi),
+	)
+	return err
+}
+
+// LastIDBlock читает последний выданный блок из последовательности, не сдвигая её
+func (s *PostgresStorage) LastIDBlock(ctx context.Context) (uint64, error) {
+	var hi int64
+	err := s.pool.QueryRow(ctx,
+		"SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM short_url_block_seq",
+	).Scan(&hi)
+	if err != nil {
+		return 0, fmt.Errorf("ошибка получения блока идентификаторов: %w", err)
+	}
+	return uint64(hi), nil
+}
+
+func (s *PostgresStorage) ForEachLink(ctx context.Context, fn func(LinkInfo) error) error {
+	rows, err := s.pool.Query(ctx, `SELECT short_url, original_url, COALESCE(submitted_url, ''), title, expires_at, user_id, correlation_id, is_deleted, COALESCE(password_hash, '')
+         FROM urls ORDER BY short_url COLLATE "C"`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var link LinkInfo
+		if err := rows.Scan(&link.ShortURL, &link.OriginalURL, &link.SubmittedURL, &link.Title, &link.ExpiresAt, &link.UserID, &link.UUID, &link.Deleted, &link.PasswordHash); err != nil {
+			return err
+		}
+		if err := fn(link); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (s *PostgresStorage) ForEachUser(ctx context.Context, fn func(userID int) error) error {
+	rows, err := s.pool.Query(ctx, "SELECT user_id FROM users ORDER BY user_id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var userID int
+		if err := rows.Scan(&userID); err != nil {
+			return err
+		}
+		if err := fn(userID); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// uniqueViolation — код ошибки PostgreSQL при нарушении уникальности
+const uniqueViolation = "23505"
+
+// isShortURLConflict сообщает, что вставка упала на уникальности short_url
+func isShortURLConflict(err error) bool {
+	return isUniqueViolation(err, "urls_short_url_key")
+}
+
+func isUniqueViolation(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) &&
+		pgErr.Code == uniqueViolation &&
+		pgErr.ConstraintName == constraint
 }
@@ -0,0 +1,89 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+// Бенчмарки пути редиректа нуждаются в PostgreSQL:
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run '^$' -bench Get ./internal/storage/
+//
+// database/sql — прежняя реализация Get через stdlib-драйвер pgx, pgxpool — текущая.
+func BenchmarkGet(b *testing.B) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		b.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+
+	store, err := NewPostgresStorage(ctx, dsn, PoolConfig{})
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer store.Close()
+
+	const links = 1000
+	userID, err := store.GetNewUser(ctx)
+	if err != nil {
+		b.Fatal(err)
+	}
+	if err := store.SaveUser(ctx, userID); err != nil {
+		b.Fatal(err)
+	}
+	prefix := fmt.Sprintf("bench%d_", userID)
+	for i := 0; i < links; i++ {
+		short := fmt.Sprintf("%s%d", prefix, i)
+		if _, err := store.Save(ctx, short, short, "https://bench.example.com/"+short, "", "", userID, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	defer store.pool.Exec(ctx, "DELETE FROM urls WHERE user_id = $1", userID)
+
+	db, err := sql.Open("pgx", dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	legacyGet := func(short string) error {
+		var originalURL string
+		var isDeleted bool
+		var expiresAt sql.NullTime
+		return db.QueryRowContext(ctx, getURLQuery, short).Scan(&originalURL, &isDeleted, &expiresAt)
+	}
+	poolGet := func(short string) error {
+		_, _, err := store.Get(ctx, short)
+		return err
+	}
+
+	for _, impl := range []struct {
+		name string
+		get  func(short string) error
+	}{
+		{"database/sql", legacyGet},
+		{"pgxpool", poolGet},
+	} {
+		b.Run(impl.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if err := impl.get(fmt.Sprintf("%s%d", prefix, i%links)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(impl.name+"/parallel", func(b *testing.B) {
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					if err := impl.get(fmt.Sprintf("%s%d", prefix, i%links)); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Тесты PostgresStorage нуждаются в PostgreSQL:
+//
+//	TEST_DATABASE_DSN=postgres://... go test -run Postgres ./internal/storage/
+func TestPostgresSaveAliasTaken(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+
+	store, err := NewPostgresStorage(ctx, dsn, PoolConfig{})
+	require.NoError(t, err)
+	defer store.Close()
+	userID, err := store.GetNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveUser(ctx, userID))
+	defer store.pool.Exec(ctx, "DELETE FROM urls WHERE user_id = $1", userID)
+
+	alias := fmt.Sprintf("alias%d", userID)
+	first := "https://example.com/" + alias + "/first"
+	_, err = store.Save(ctx, NewCorrelationID(), alias, first, "", "", userID, nil)
+	require.NoError(t, err)
+
+	// Занятый код — это конфликт псевдонима, а не повтор адреса
+	short, err := store.Save(ctx, NewCorrelationID(), alias, "https://example.com/"+alias+"/second", "", "", userID, nil)
+	assert.ErrorIs(t, err, ErrShortURLTaken)
+	assert.Empty(t, short)
+
+	// Повтор адреса под другим кодом по-прежнему возвращает существующий код
+	short, err = store.Save(ctx, NewCorrelationID(), alias+"_other", first, "", "", userID, nil)
+	assert.ErrorIs(t, err, ErrURLAlreadyExists)
+	assert.Equal(t, alias, short)
+}
+
+func TestPostgresDedupScopeStored(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	ctx := context.Background()
+
+	store, err := NewPostgresStorage(ctx, dsn, PoolConfig{})
+	require.NoError(t, err)
+	defer store.Close()
+	previous, err := storedDedupScope(ctx, store.pool)
+	require.NoError(t, err)
+	if previous != "" {
+		defer store.SetDedupScope(ctx, previous)
+	}
+
+	require.NoError(t, store.SetDedupScope(ctx, DedupNone))
+	scope, err := storedDedupScope(ctx, store.pool)
+	require.NoError(t, err)
+	assert.Equal(t, DedupNone, scope)
+
+	// Та же область не пересчитывает ключи: пересчёт снял бы вручную выставленный ключ
+	userID, err := store.GetNewUser(ctx)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveUser(ctx, userID))
+	defer store.pool.Exec(ctx, "DELETE FROM urls WHERE user_id = $1", userID)
+	short := fmt.Sprintf("scope%d", userID)
+	_, err = store.Save(ctx, NewCorrelationID(), short, "https://example.com/"+short, "", "", userID, nil)
+	require.NoError(t, err)
+	_, err = store.pool.Exec(ctx, "UPDATE urls SET dedup_key = short_url WHERE short_url = $1", short)
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetDedupScope(ctx, DedupNone))
+	var key *string
+	require.NoError(t, store.pool.QueryRow(ctx, "SELECT dedup_key FROM urls WHERE short_url = $1", short).Scan(&key))
+	require.NotNil(t, key)
+	assert.Equal(t, short, *key)
+
+	// Смена области пересчитывает ключи и запоминает новую
+	require.NoError(t, store.SetDedupScope(ctx, DedupUser))
+	require.NoError(t, store.pool.QueryRow(ctx, "SELECT dedup_key FROM urls WHERE short_url = $1", short).Scan(&key))
+	require.NotNil(t, key)
+	assert.Equal(t, fmt.Sprintf("%d:https://example.com/%s", userID, short), *key)
+	scope, err = storedDedupScope(ctx, store.pool)
+	require.NoError(t, err)
+	assert.Equal(t, DedupUser, scope)
+}
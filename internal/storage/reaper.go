@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Reaper периодически удаляет из хранилища ссылки с истёкшим сроком действия
+type Reaper struct {
+	store    Storage
+	sugar    *zap.SugaredLogger
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewReaper(store Storage, interval time.Duration, sugar *zap.SugaredLogger) *Reaper {
+	r := &Reaper{
+		store:    store,
+		sugar:    sugar,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Close останавливает фоновую очистку
+func (r *Reaper) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		<-r.done
+	})
+}
+
+func (r *Reaper) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.purge()
+		}
+	}
+}
+
+func (r *Reaper) purge() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	purged, err := r.store.PurgeExpired(ctx, time.Now())
+	if err != nil {
+		r.sugar.Error("Ошибка очистки истёкших ссылок:", err)
+		return
+	}
+	if purged > 0 {
+		r.sugar.Infof("Удалено истёкших ссылок: %d", purged)
+	}
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey — ключ advisory-блокировки, под которой реплики применяют миграции по очереди
+const migrationLockKey = 7_146_552_301
+
+var (
+	ErrUnknownMigration = errors.New("неизвестная версия миграции")
+	ErrSchemaAhead      = errors.New("схема новее целевой версии")
+)
+
+// Migration — версия схемы: пара файлов NNNN_name.up.sql и NNNN_name.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus — миграция и время её применения (nil, если не применена)
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrations возвращает встроенные миграции по возрастанию версий
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := strings.Cut(strings.TrimSuffix(name, ".sql"), ".")
+		versionText, title, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionText)
+		if !ok || !found || err != nil || version <= 0 {
+			return nil, fmt.Errorf("некорректное имя миграции %s", name)
+		}
+		body, err := migrationFiles.ReadFile(path.Join("migrations", name))
+		if err != nil {
+			return nil, err
+		}
+
+		migration, exists := byVersion[version]
+		if !exists {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		switch direction {
+		case "up":
+			migration.Up = string(body)
+		case "down":
+			migration.Down = string(body)
+		default:
+			return nil, fmt.Errorf("некорректное имя миграции %s", name)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("у миграции %d нет up или down", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("пропущена миграция %d", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrateUp применяет миграции до версии target включительно (0 — до последней)
+// и возвращает применённые миграции
+func (s *PostgresStorage) MigrateUp(ctx context.Context, target int) ([]Migration, error) {
+	var applied []Migration
+	err := s.withMigrationLock(ctx, func(conn *pgxpool.Conn, migrations []Migration, current int) error {
+		pending, err := pendingMigrations(migrations, current, target)
+		if err != nil {
+			return err
+		}
+		for _, migration := range pending {
+			err := runMigration(ctx, conn, migration.Up,
+				"INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("ошибка миграции %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// pendingMigrations возвращает миграции, которые поднимают схему с версии current до target (0 — до последней)
+func pendingMigrations(migrations []Migration, current, target int) ([]Migration, error) {
+	if target == 0 {
+		target = len(migrations)
+	}
+	if target < 0 || target > len(migrations) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+	}
+	if target < current {
+		return nil, fmt.Errorf("%w: схема уже версии %d, для отката используйте migrate down", ErrSchemaAhead, current)
+	}
+	return migrations[current:target], nil
+}
+
+// MigrateDown откатывает миграции, пока версия схемы не станет равна target,
+// и возвращает откаченные миграции
+func (s *PostgresStorage) MigrateDown(ctx context.Context, target int) ([]Migration, error) {
+	var reverted []Migration
+	err := s.withMigrationLock(ctx, func(conn *pgxpool.Conn, migrations []Migration, current int) error {
+		if target < 0 || target > len(migrations) {
+			return fmt.Errorf("%w: %d", ErrUnknownMigration, target)
+		}
+		for version := current; version > target; version-- {
+			migration := migrations[version-1]
+			err := runMigration(ctx, conn, migration.Down,
+				"DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("ошибка отката миграции %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// MigrationStatus возвращает все встроенные миграции с отметкой о применении
+func (s *PostgresStorage) MigrationStatus(ctx context.Context) ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	// Статус только читает схему, поэтому таблицу миграций не создаём
+	var tracked bool
+	if err := s.pool.QueryRow(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&tracked); err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]time.Time{}
+	if tracked {
+		if err := s.appliedMigrations(ctx, appliedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Migration: migration}
+		if at, ok := appliedAt[migration.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func (s *PostgresStorage) appliedMigrations(ctx context.Context, appliedAt map[int]time.Time) error {
+	rows, err := s.pool.Query(ctx, "SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return err
+		}
+		appliedAt[version] = at
+	}
+	return rows.Err()
+}
+
+// withMigrationLock выполняет fn на одном соединении под advisory-блокировкой,
+// передавая встроенные миграции и текущую версию схемы
+func (s *PostgresStorage) withMigrationLock(ctx context.Context, fn func(conn *pgxpool.Conn, migrations []Migration, current int) error) error {
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	// Сессионная блокировка принадлежит соединению, поэтому всё делаем на нём
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", migrationLockKey); err != nil {
+		return fmt.Errorf("ошибка блокировки миграций: %w", err)
+	}
+	defer conn.Exec(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockKey)
+
+	if err := ensureMigrationsTable(ctx, conn); err != nil {
+		return err
+	}
+	var current int
+	err = conn.QueryRow(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current > len(migrations) {
+		return fmt.Errorf("%w: схема версии %d новее этой сборки", ErrUnknownMigration, current)
+	}
+	return fn(conn, migrations, current)
+}
+
+func ensureMigrationsTable(ctx context.Context, conn *pgxpool.Conn) error {
+	_, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	return err
+}
+
+// runMigration выполняет скрипт миграции и запись в schema_migrations в одной транзакции
+func runMigration(ctx context.Context, conn *pgxpool.Conn, script string, record string, args ...any) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Без аргументов pgx выполняет скрипт простым протоколом, поэтому в нём может быть несколько команд
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
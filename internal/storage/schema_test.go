@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version)
+		assert.NotEmpty(t, migration.Name)
+		assert.NotEmpty(t, migration.Up, "migration %d has no up script", migration.Version)
+		assert.NotEmpty(t, migration.Down, "migration %d has no down script", migration.Version)
+	}
+	assert.Equal(t, "init", migrations[0].Name)
+}
+
+func TestPendingMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	require.NoError(t, err)
+	latest := len(migrations)
+
+	pending, err := pendingMigrations(migrations, 0, 0)
+	require.NoError(t, err)
+	assert.Len(t, pending, latest)
+
+	pending, err = pendingMigrations(migrations, 1, 2)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, 2, pending[0].Version)
+
+	pending, err = pendingMigrations(migrations, latest, 0)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	// Подъём до версии ниже текущей — ошибка, а не откат и не паника
+	_, err = pendingMigrations(migrations, latest, 2)
+	assert.ErrorIs(t, err, ErrSchemaAhead)
+
+	_, err = pendingMigrations(migrations, 0, latest+1)
+	assert.ErrorIs(t, err, ErrUnknownMigration)
+}
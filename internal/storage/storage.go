@@ -2,41 +2,175 @@ package storage
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var (
 	ErrURLAlreadyExists = errors.New("URL уже существует в базе данных")
 	ErrUserNotFound     = errors.New("пользователь не найден")
+	ErrURLDeleted       = errors.New("URL удален")
+	ErrURLNotFound      = errors.New("URL не найден")
+	ErrURLExpired       = errors.New("срок действия URL истёк")
+	ErrShortURLTaken    = errors.New("короткая ссылка уже занята")
+	ErrUUIDTaken        = errors.New("UUID ссылки уже занят")
 )
 
 type InfoAboutURL struct {
-	CorrelationID string `json:"correlation_id"`
-	OriginalURL   string `json:"original_url"`
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int        `json:"ttl_seconds,omitempty"`
+	Alias         string     `json:"alias,omitempty"`
 	ShortLink     string
+	// SubmittedURL — адрес в том виде, в каком его прислал пользователь, если он отличается от канонического OriginalURL
+	SubmittedURL string `json:"-"`
+	// Password — пароль из запроса, PasswordHash — его солёный хеш, который и сохраняется
+	Password     string `json:"password,omitempty"`
+	PasswordHash string `json:"-"`
+}
+
+// BatchStatus — исход сохранения одной ссылки пакета
+type BatchStatus string
+
+const (
+	BatchCreated BatchStatus = "created"
+	BatchExists  BatchStatus = "exists"
+	BatchInvalid BatchStatus = "invalid"
+	BatchBlocked BatchStatus = "blocked"
+	BatchError   BatchStatus = "error"
+)
+
+// BatchResult — итог сохранения одной ссылки пакета.
+// Для BatchExists ShortURL — прежняя ссылка, для BatchInvalid и BatchError причина в Err.
+type BatchResult struct {
+	CorrelationID string
+	ShortURL      string
+	Status        BatchStatus
+	Err           error
+}
+
+// DeleteRequest — запрос пользователя на удаление его сокращённых ссылок
+type DeleteRequest struct {
+	UserID    int
+	ShortURLs []string
+}
+
+// LinkInfo — полные сведения о сокращённой ссылке
+type LinkInfo struct {
+	ShortURL     string     `json:"short_url"`
+	OriginalURL  string     `json:"original_url"`
+	SubmittedURL string     `json:"submitted_url,omitempty"`
+	Title        string     `json:"title,omitempty"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+	UserID       int        `json:"-"`
+	UUID         string     `json:"-"`
+	Deleted      bool       `json:"-"`
+	// PasswordHash — солёный хеш пароля, пустой у ссылок без пароля
+	PasswordHash string `json:"-"`
+}
+
+// LinkUpdate — изменения ссылки, nil-поля остаются прежними
+type LinkUpdate struct {
+	OriginalURL *string
+	// SubmittedURL заменяет присланный адрес вместе с OriginalURL, nil — адрес прислан в канонической форме
+	SubmittedURL *string
+	Title        *string
+	ExpiresAt    *time.Time
+}
+
+// HistoryEntry — одна смена адреса назначения ссылки
+type HistoryEntry struct {
+	Version   int       `json:"version"`
+	OldURL    string    `json:"old_url"`
+	NewURL    string    `json:"new_url"`
+	UserID    int       `json:"user_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Click — один переход по короткой ссылке
+type Click struct {
+	ShortURL  string
+	Time      time.Time
+	Referrer  string
+	UserAgent string
+	IPHash    string
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+// LinkStats — агрегированная статистика переходов по ссылке
+type LinkStats struct {
+	TotalClicks    int           `json:"total_clicks"`
+	UniqueVisitors int           `json:"unique_visitors"`
+	Daily          []DailyClicks `json:"daily"`
 }
 
 type (
 	Storage interface {
-		Save(ctx context.Context, correlationID string, short string, original string, userID int) (string, error)
-		Get(ctx context.Context, original string) (string, bool, error)
+		Save(ctx context.Context, correlationID string, short string, original string, submitted string, passwordHash string, userID int, expiresAt *time.Time) (string, error)
+		// Get — горячий путь редиректа: адрес, срок действия, признак удаления и хеш пароля ссылки.
+		// Для удалённой или истёкшей ссылки возвращает её сведения вместе с ErrURLDeleted или ErrURLExpired.
+		Get(ctx context.Context, short string) (LinkInfo, bool, error)
+		GetLinks(ctx context.Context, shorts []string) (map[string]LinkInfo, error)
 		Len(ctx context.Context) int
 		Ping(ctx context.Context) error
 		GetFromOriginal(ctx context.Context, original string) (string, error)
+		GetLinksByOriginal(ctx context.Context, original string) ([]LinkInfo, error)
 		SaveUser(ctx context.Context, userID int) error
 		GetUserFromID(ctx context.Context, userID int) (bool, error)
 		GetNewUser(ctx context.Context) (int, error)
 		GetLinksByUserID(ctx context.Context, userID int) (map[string]string, error)
-		AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]string, error)
+		AddLinksBatch(ctx context.Context, links []InfoAboutURL, userID int) ([]BatchResult, error)
+		DeleteUserLinks(ctx context.Context, requests []DeleteRequest) error
+		GetLinkOwner(ctx context.Context, short string) (int, error)
+		SaveClicks(ctx context.Context, clicks []Click) error
+		GetLinkStats(ctx context.Context, short string) (*LinkStats, error)
+		PurgeExpired(ctx context.Context, now time.Time) (int, error)
+		Update(ctx context.Context, short string, userID int, update LinkUpdate) (*LinkInfo, error)
+		GetHistory(ctx context.Context, short string) ([]HistoryEntry, error)
+		NextIDBlock(ctx context.Context) (uint64, error)
+		ReserveIDBlock(ctx context.Context, hi uint64) error
+		// LastIDBlock возвращает последний выданный или зарезервированный блок идентификаторов, 0 — если их не было
+		LastIDBlock(ctx context.Context) (uint64, error)
+		// ForEachLink обходит все ссылки по возрастанию коротких кодов в побайтовом порядке,
+		// как их сравнивает Go: на нём основано продолжение переноса с контрольной точки
+		ForEachLink(ctx context.Context, fn func(LinkInfo) error) error
+		ForEachUser(ctx context.Context, fn func(userID int) error) error
+		SetDedupScope(ctx context.Context, scope DedupScope) error
+	}
+
+	linkRecord struct {
+		uuid      string
+		original  string
+		submitted string
+		password  string
+		userID    int
+		title     string
+		deleted   bool
+		expiresAt *time.Time
 	}
 
 	LinkStorage struct {
-		links     map[string]string
+		mu        sync.RWMutex
+		links     map[string]*linkRecord
 		users     map[int]bool
 		userLinks map[int][]string
+		// byOriginal — обратный индекс: адрес назначения → короткие коды в порядке привязки
+		byOriginal map[string][]string
+		clicks     map[string][]Click
+		history    map[string][]HistoryEntry
+		idBlock    uint64
+		dedup      DedupScope
 	}
 	PostgresStorage struct {
-		db *sql.DB
+		pool  *pgxpool.Pool
+		dedup DedupScope
 	}
 )
@@ -0,0 +1,263 @@
+package vetting
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Длина префикса хеша в списке — от 4 до 32 байт, как в Safe Browsing
+const (
+	minHashPrefix = 4
+	maxHashPrefix = sha256.Size
+)
+
+// Blocklist проверяет адреса по локальным спискам: доменам, регулярным выражениям
+// и префиксам SHA-256 выражений адреса в стиле Safe Browsing.
+// Каждый список — файл, по одной записи в строке, строки с # — комментарии.
+type Blocklist struct {
+	domainsPath  string
+	patternsPath string
+	hashesPath   string
+
+	mu       sync.RWMutex
+	lists    lists
+	versions map[string]fileVersion
+}
+
+type lists struct {
+	domains  map[string]bool
+	patterns []*regexp.Regexp
+	hashes   map[string]bool
+	// lengths — длины префиксов в hex, которые встречаются в hashes
+	lengths []int
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewBlocklist загружает списки из файлов. Пустой путь означает, что список не используется.
+func NewBlocklist(domainsPath, patternsPath, hashesPath string) (*Blocklist, error) {
+	b := &Blocklist{domainsPath: domainsPath, patternsPath: patternsPath, hashesPath: hashesPath}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload перечитывает списки, если хоть один файл изменился, и сообщает, были ли изменения.
+// При ошибке продолжают действовать прежние списки.
+func (b *Blocklist) Reload() (bool, error) {
+	versions := map[string]fileVersion{}
+	for _, path := range []string{b.domainsPath, b.patternsPath, b.hashesPath} {
+		if path == "" {
+			continue
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return false, err
+		}
+		versions[path] = fileVersion{modTime: stat.ModTime(), size: stat.Size()}
+	}
+
+	b.mu.RLock()
+	changed := b.versions == nil || !sameVersions(b.versions, versions)
+	b.mu.RUnlock()
+	if !changed {
+		return false, nil
+	}
+
+	loaded, err := b.load()
+	if err != nil {
+		return false, err
+	}
+	b.mu.Lock()
+	b.lists, b.versions = loaded, versions
+	b.mu.Unlock()
+	return true, nil
+}
+
+func sameVersions(a, b map[string]fileVersion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, version := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(version.modTime) || other.size != version.size {
+			return false
+		}
+	}
+	return true
+}
+
+func (b *Blocklist) load() (lists, error) {
+	loaded := lists{domains: map[string]bool{}, hashes: map[string]bool{}}
+
+	domains, err := readLines(b.domainsPath)
+	if err != nil {
+		return lists{}, err
+	}
+	for _, domain := range domains {
+		loaded.domains[strings.TrimSuffix(strings.ToLower(domain), ".")] = true
+	}
+
+	patterns, err := readLines(b.patternsPath)
+	if err != nil {
+		return lists{}, err
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return lists{}, fmt.Errorf("%s: %w", b.patternsPath, err)
+		}
+		loaded.patterns = append(loaded.patterns, re)
+	}
+
+	hashes, err := readLines(b.hashesPath)
+	if err != nil {
+		return lists{}, err
+	}
+	lengths := map[int]bool{}
+	for _, prefix := range hashes {
+		prefix = strings.ToLower(prefix)
+		raw, err := hex.DecodeString(prefix)
+		if err != nil || len(raw) < minHashPrefix || len(raw) > maxHashPrefix {
+			return lists{}, fmt.Errorf("%s: некорректный префикс хеша %q", b.hashesPath, prefix)
+		}
+		loaded.hashes[prefix] = true
+		lengths[len(prefix)] = true
+	}
+	for length := range lengths {
+		loaded.lengths = append(loaded.lengths, length)
+	}
+	sort.Ints(loaded.lengths)
+	return loaded, nil
+}
+
+func readLines(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// Check блокирует адрес, если его хост или родительский домен в списке доменов,
+// адрес совпал с регулярным выражением или хеш одного из его выражений начинается с префикса из списка
+func (b *Blocklist) Check(_ context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	if domain, ok := matchDomain(b.lists.domains, u.Hostname()); ok {
+		return &BlockedError{Rule: RuleDomain, Match: domain}
+	}
+
+	for _, re := range b.lists.patterns {
+		if re.MatchString(rawURL) {
+			return &BlockedError{Rule: RulePattern, Match: re.String()}
+		}
+	}
+
+	if len(b.lists.hashes) > 0 {
+		for _, expression := range Expressions(u) {
+			sum := sha256.Sum256([]byte(expression))
+			hash := hex.EncodeToString(sum[:])
+			for _, length := range b.lists.lengths {
+				if b.lists.hashes[hash[:length]] {
+					return &BlockedError{Rule: RuleHashPrefix, Match: hash[:length]}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// matchDomain ищет в domains хост или один из его родительских доменов
+func matchDomain(domains map[string]bool, host string) (string, bool) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	for domain := host; domain != ""; {
+		if domains[domain] {
+			return domain, true
+		}
+		_, parent, found := strings.Cut(domain, ".")
+		if !found {
+			break
+		}
+		domain = parent
+	}
+	return "", false
+}
+
+// Expressions возвращает выражения адреса, хеши которых сверяются со списком префиксов:
+// комбинации хоста и до четырёх его родительских доменов с полным путём,
+// путём без запроса и до четырёх префиксов пути — как в Safe Browsing
+func Expressions(u *url.URL) []string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	hosts := []string{host}
+	if net.ParseIP(host) == nil {
+		parts := strings.Split(host, ".")
+		for i := max(1, len(parts)-5); i < len(parts)-1; i++ {
+			hosts = append(hosts, strings.Join(parts[i:], "."))
+		}
+	}
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	var paths []string
+	if u.RawQuery != "" {
+		paths = append(paths, path+"?"+u.RawQuery)
+	}
+	paths = append(paths, path)
+	prefix := "/"
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i := 0; len(paths) < 6 && i <= len(segments)-1; i++ {
+		if prefix != path {
+			paths = append(paths, prefix)
+		}
+		prefix += segments[i] + "/"
+	}
+
+	expressions := make([]string, 0, len(hosts)*len(paths))
+	seen := map[string]bool{}
+	for _, h := range hosts {
+		for _, p := range paths {
+			if expression := h + p; !seen[expression] {
+				seen[expression] = true
+				expressions = append(expressions, expression)
+			}
+		}
+	}
+	return expressions
+}
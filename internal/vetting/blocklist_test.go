@@ -0,0 +1,148 @@
+package vetting
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func writeList(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func hashPrefix(expression string) string {
+	sum := sha256.Sum256([]byte(expression))
+	return hex.EncodeToString(sum[:4])
+}
+
+func TestBlocklist(t *testing.T) {
+	dir := t.TempDir()
+	domains := filepath.Join(dir, "domains.txt")
+	patterns := filepath.Join(dir, "patterns.txt")
+	hashes := filepath.Join(dir, "hashes.txt")
+	writeList(t, domains, "# фишинг\nevil.example\n\n")
+	writeList(t, patterns, `^https?://[^/]+/login\.php`+"\n")
+	writeList(t, hashes, hashPrefix("bad.example/malware/")+"\n")
+
+	list, err := NewBlocklist(domains, patterns, hashes)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url  string
+		rule string
+	}{
+		{"https://evil.example/", RuleDomain},
+		{"https://login.evil.example/path", RuleDomain},
+		{"https://notevil.example/", ""},
+		{"http://shop.example/login.php?next=/", RulePattern},
+		{"https://bad.example/malware/payload.exe?x=1", RuleHashPrefix},
+		{"https://www.bad.example/malware/", RuleHashPrefix},
+		{"https://bad.example/clean/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			err := list.Check(context.Background(), tt.url)
+			if tt.rule == "" {
+				assert.NoError(t, err)
+				return
+			}
+			var blocked *BlockedError
+			require.ErrorAs(t, err, &blocked)
+			assert.Equal(t, tt.rule, blocked.Rule)
+			assert.True(t, errors.Is(err, ErrBlocked))
+		})
+	}
+}
+
+func TestBlocklistReload(t *testing.T) {
+	ctx := context.Background()
+	domains := filepath.Join(t.TempDir(), "domains.txt")
+	writeList(t, domains, "evil.example\n")
+
+	list, err := NewBlocklist(domains, "", "")
+	require.NoError(t, err)
+	changed, err := list.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	store := storage.NewLinkStorage()
+	_, err = store.Save(ctx, "1", "good", "https://good.example/", "", "", 1, nil)
+	require.NoError(t, err)
+	_, err = store.Save(ctx, "2", "later", "https://later.example/", "", "", 2, nil)
+	require.NoError(t, err)
+
+	writeList(t, domains, "evil.example\nlater.example\n")
+	// Время изменения файла может совпасть с прежним, размер же другой
+	changed, err = list.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.ErrorIs(t, list.Check(ctx, "https://later.example/"), ErrBlocked)
+
+	blocked, err := Recheck(ctx, store, list)
+	require.NoError(t, err)
+	assert.Equal(t, map[int][]string{2: {"later"}}, blocked)
+
+	// Некорректный список не загружается, а ошибка перечитывания не отменяет действующие списки
+	patterns := filepath.Join(t.TempDir(), "patterns.txt")
+	writeList(t, patterns, "(\n")
+	_, err = NewBlocklist("", patterns, "")
+	assert.Error(t, err)
+	require.NoError(t, os.Remove(domains))
+	_, err = list.Reload()
+	assert.Error(t, err)
+	assert.ErrorIs(t, list.Check(ctx, "https://evil.example/"), ErrBlocked)
+}
+
+func TestWatcher(t *testing.T) {
+	ctx := context.Background()
+	domains := filepath.Join(t.TempDir(), "domains.txt")
+	writeList(t, domains, "# пока пусто\n")
+	list, err := NewBlocklist(domains, "", "")
+	require.NoError(t, err)
+
+	store := storage.NewLinkStorage()
+	_, err = store.Save(ctx, "1", "phish", "https://phish.example/", "", "", 1, nil)
+	require.NoError(t, err)
+
+	core, logs := observer.New(zap.WarnLevel)
+	watcher := NewWatcher(list, store, 10*time.Millisecond, zap.New(core).Sugar())
+	defer watcher.Close()
+
+	writeList(t, domains, "phish.example\n")
+	assert.Eventually(t, func() bool {
+		return logs.Len() > 0
+	}, 3*time.Second, 20*time.Millisecond)
+	assert.Contains(t, logs.All()[0].Message, "phish")
+
+	// Ошибочно попавшая под список ссылка не удаляется
+	link, found, err := store.Get(ctx, "phish")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.False(t, link.Deleted)
+}
+
+func TestExpressions(t *testing.T) {
+	u, err := url.Parse("http://a.b.c.d.e.f.g/1/2.html?param=1")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{
+		"a.b.c.d.e.f.g/1/2.html?param=1", "a.b.c.d.e.f.g/1/2.html", "a.b.c.d.e.f.g/", "a.b.c.d.e.f.g/1/",
+		"c.d.e.f.g/1/2.html?param=1", "c.d.e.f.g/1/2.html", "c.d.e.f.g/", "c.d.e.f.g/1/",
+		"d.e.f.g/1/2.html?param=1", "d.e.f.g/1/2.html", "d.e.f.g/", "d.e.f.g/1/",
+		"e.f.g/1/2.html?param=1", "e.f.g/1/2.html", "e.f.g/", "e.f.g/1/",
+		"f.g/1/2.html?param=1", "f.g/1/2.html", "f.g/", "f.g/1/",
+	}, Expressions(u))
+}
@@ -0,0 +1,231 @@
+package vetting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Правила, которыми отклоняются ссылки на себя и на другие сокращатели
+const (
+	RuleSelfReference = "self_reference"
+	RuleShortener     = "shortener"
+	RuleUnresolved    = "unresolved"
+)
+
+// Политика для адресов других сокращателей, задаётся флагом -shortener-policy
+type ShortenerPolicy string
+
+const (
+	// ShortenerAllow сокращает такие адреса как обычные
+	ShortenerAllow ShortenerPolicy = "allow"
+	// ShortenerReject отклоняет такие адреса
+	ShortenerReject ShortenerPolicy = "reject"
+	// ShortenerUnwrap заменяет адрес конечным адресом назначения, пройдя по перенаправлениям
+	ShortenerUnwrap ShortenerPolicy = "unwrap"
+)
+
+// DefaultShortenerDomains — известные сокращатели ссылок
+var DefaultShortenerDomains = []string{
+	"bit.ly", "tinyurl.com", "t.co", "goo.gl", "ow.ly", "is.gd", "buff.ly", "rebrand.ly", "cutt.ly", "tiny.cc", "shorturl.at",
+}
+
+var (
+	ErrUnknownPolicy    = errors.New("неизвестная политика для адресов сокращателей")
+	ErrTooManyRedirects = errors.New("слишком много перенаправлений")
+	ErrRedirectLoop     = errors.New("перенаправления зациклились")
+)
+
+// ParseShortenerPolicy разбирает значение флага -shortener-policy, пустое значение означает ShortenerReject
+func ParseShortenerPolicy(value string) (ShortenerPolicy, error) {
+	switch policy := ShortenerPolicy(value); policy {
+	case "":
+		return ShortenerReject, nil
+	case ShortenerAllow, ShortenerReject, ShortenerUnwrap:
+		return policy, nil
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnknownPolicy, value)
+}
+
+// CheckSelfReference блокирует адрес, который ведёт на сам сервис с базовым адресом base:
+// такая ссылка перенаправляла бы на другую короткую ссылку или сама на себя
+func CheckSelfReference(base, rawURL string) error {
+	baseURL, err := url.Parse(base)
+	if err != nil || baseURL.Host == "" {
+		return nil
+	}
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if hostKey(target) == hostKey(baseURL) {
+		return &BlockedError{Rule: RuleSelfReference, Match: baseURL.Host}
+	}
+	return nil
+}
+
+// hostKey — хост и порт адреса с подставленным портом по умолчанию для схемы
+func hostKey(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPorts[strings.ToLower(u.Scheme)]
+	}
+	return net.JoinHostPort(strings.TrimSuffix(strings.ToLower(u.Hostname()), "."), port)
+}
+
+var defaultPorts = map[string]string{"http": "80", "https": "443"}
+
+// Unwrapper применяет политику к адресам известных сокращателей
+type Unwrapper struct {
+	domains  map[string]bool
+	policy   ShortenerPolicy
+	resolver *Resolver
+}
+
+// NewUnwrapper создаёт Unwrapper для доменов domains. resolver нужен только для ShortenerUnwrap.
+func NewUnwrapper(domains []string, policy ShortenerPolicy, resolver *Resolver) *Unwrapper {
+	u := &Unwrapper{domains: map[string]bool{}, policy: policy, resolver: resolver}
+	for _, domain := range domains {
+		u.domains[strings.TrimSuffix(strings.ToLower(domain), ".")] = true
+	}
+	if resolver != nil {
+		resolver.isShortener = u.isShortener
+	}
+	return u
+}
+
+func (u *Unwrapper) isShortener(target *url.URL) (string, bool) {
+	return matchDomain(u.domains, target.Hostname())
+}
+
+func (u *Unwrapper) isShortenerURL(target *url.URL) bool {
+	_, ok := u.isShortener(target)
+	return ok
+}
+
+// Unwrap возвращает адрес, который следует сократить вместо rawURL.
+// Адрес не сокращателя возвращается как есть.
+func (u *Unwrapper) Unwrap(ctx context.Context, rawURL string) (string, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	domain, ok := u.isShortener(target)
+	if !ok || u.policy == ShortenerAllow {
+		return rawURL, nil
+	}
+	if u.policy == ShortenerReject {
+		return "", &BlockedError{Rule: RuleShortener, Match: domain}
+	}
+
+	final, err := u.resolver.Resolve(ctx, rawURL)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", &BlockedError{Rule: RuleUnresolved, Match: domain}, err)
+	}
+	// Сокращатель не перенаправил — конечный адрес неизвестен
+	if finalURL, err := url.Parse(final); err != nil || u.isShortenerURL(finalURL) {
+		return "", &BlockedError{Rule: RuleUnresolved, Match: domain}
+	}
+	return final, nil
+}
+
+// Resolver проходит по перенаправлениям сокращателей до адреса вне их доменов.
+// Запросы отправляются только на домены сокращателей, число переходов ограничено.
+type Resolver struct {
+	client  *http.Client
+	maxHops int
+	// isShortener задаёт Unwrapper, без него проходятся все перенаправления
+	isShortener func(*url.URL) (string, bool)
+}
+
+// NewResolver создаёт Resolver, который делает не больше maxHops запросов, каждый не дольше timeout
+func NewResolver(maxHops int, timeout time.Duration) *Resolver {
+	return &Resolver{
+		maxHops: maxHops,
+		client: &http.Client{
+			Timeout: timeout,
+			// Перенаправления разбираются вручную, чтобы считать переходы и не ходить на чужие домены
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// Resolve возвращает конечный адрес цепочки перенаправлений, начинающейся с rawURL
+func (r *Resolver) Resolve(ctx context.Context, rawURL string) (string, error) {
+	current, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	seen := map[string]bool{}
+	for hop := 0; ; hop++ {
+		if r.isShortener != nil {
+			if _, ok := r.isShortener(current); !ok {
+				return current.String(), nil
+			}
+		}
+		if seen[current.String()] {
+			return "", ErrRedirectLoop
+		}
+		if hop == r.maxHops {
+			return "", ErrTooManyRedirects
+		}
+		seen[current.String()] = true
+
+		next, err := r.next(ctx, current)
+		if err != nil {
+			return "", err
+		}
+		if next == nil {
+			return current.String(), nil
+		}
+		current = next
+	}
+}
+
+// next делает один запрос и возвращает адрес перенаправления или nil, если его нет
+func (r *Resolver) next(ctx context.Context, current *url.URL) (*url.URL, error) {
+	resp, err := r.request(ctx, http.MethodHead, current)
+	// Часть сокращателей не поддерживает HEAD
+	if err == nil && resp.StatusCode == http.StatusMethodNotAllowed {
+		resp, err = r.request(ctx, http.MethodGet, current)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+	default:
+		return nil, nil
+	}
+	location, err := resp.Location()
+	if err != nil {
+		return nil, err
+	}
+	if location.Scheme != "http" && location.Scheme != "https" {
+		return nil, fmt.Errorf("перенаправление на %q", location.String())
+	}
+	return location, nil
+}
+
+func (r *Resolver) request(ctx context.Context, method string, target *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	// Тело не нужно: адрес перенаправления в заголовке
+	resp.Body.Close()
+	return resp, nil
+}
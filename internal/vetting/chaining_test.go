@@ -0,0 +1,112 @@
+package vetting
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckSelfReference(t *testing.T) {
+	tests := []struct {
+		base    string
+		target  string
+		blocked bool
+	}{
+		{"http://localhost:8080/", "http://localhost:8080/abcdefg", true},
+		{"http://localhost:8080/", "http://LOCALHOST:8080/api/shorten", true},
+		{"https://sho.rt/", "https://sho.rt:443/abc", true},
+		{"https://sho.rt", "https://sho.rt./abc", true},
+		{"https://sho.rt/", "http://sho.rt/abc", false},
+		{"https://sho.rt/", "https://sub.sho.rt/abc", false},
+		{"http://localhost:8080/", "http://localhost:8081/", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			err := CheckSelfReference(tt.base, tt.target)
+			if !tt.blocked {
+				assert.NoError(t, err)
+				return
+			}
+			var blocked *BlockedError
+			require.ErrorAs(t, err, &blocked)
+			assert.Equal(t, RuleSelfReference, blocked.Rule)
+		})
+	}
+}
+
+func TestUnwrapper(t *testing.T) {
+	ctx := context.Background()
+	var requests int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		switch r.URL.Path {
+		case "/hop":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		case "/final":
+			http.Redirect(w, r, "https://example.com/destination", http.StatusFound)
+		case "/head-not-allowed":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			http.Redirect(w, r, "https://example.com/from-get", http.StatusFound)
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		case "/long":
+			http.Redirect(w, r, "/long?n="+r.URL.Query().Get("n")+"1", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+	host := mustHost(t, server.URL)
+
+	unwrapper := NewUnwrapper([]string{host}, ShortenerUnwrap, NewResolver(3, time.Second))
+
+	final, err := unwrapper.Unwrap(ctx, server.URL+"/hop")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/destination", final)
+
+	final, err = unwrapper.Unwrap(ctx, server.URL+"/head-not-allowed")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/from-get", final)
+
+	// Адрес вне доменов сокращателей не запрашивается
+	requests = 0
+	final, err = unwrapper.Unwrap(ctx, "https://example.com/page")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/page", final)
+	assert.Zero(t, requests)
+
+	for path, cause := range map[string]error{"/loop": ErrRedirectLoop, "/long": ErrTooManyRedirects, "/no-redirect": nil} {
+		_, err := unwrapper.Unwrap(ctx, server.URL+path)
+		var blocked *BlockedError
+		require.ErrorAs(t, err, &blocked, path)
+		assert.Equal(t, RuleUnresolved, blocked.Rule, path)
+		if cause != nil {
+			assert.ErrorIs(t, err, cause, path)
+		}
+	}
+
+	_, err = NewUnwrapper([]string{host}, ShortenerReject, nil).Unwrap(ctx, server.URL+"/hop")
+	var blocked *BlockedError
+	require.ErrorAs(t, err, &blocked)
+	assert.Equal(t, RuleShortener, blocked.Rule)
+
+	final, err = NewUnwrapper([]string{host}, ShortenerAllow, nil).Unwrap(ctx, server.URL+"/hop")
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/hop", final)
+}
+
+func mustHost(t *testing.T, rawURL string) string {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	require.NoError(t, err)
+	return u.Hostname()
+}
@@ -0,0 +1,49 @@
+// Package vetting проверяет адреса назначения перед сокращением, чтобы сервис
+// не раздавал ссылки на фишинговые и вредоносные сайты.
+package vetting
+
+import (
+	"context"
+	"errors"
+)
+
+// Правила, по которым адрес может быть заблокирован
+const (
+	RuleDomain     = "domain"
+	RulePattern    = "pattern"
+	RuleHashPrefix = "hash_prefix"
+)
+
+var ErrBlocked = errors.New("адрес назначения заблокирован")
+
+// BlockedError сообщает, каким правилом заблокирован адрес
+type BlockedError struct {
+	Rule  string
+	Match string
+}
+
+func (e *BlockedError) Error() string {
+	return ErrBlocked.Error() + ": " + e.Rule + " " + e.Match
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrBlocked
+}
+
+// Checker — стадия проверки адреса назначения.
+// Заблокированный адрес возвращает *BlockedError, другие ошибки означают сбой проверки.
+type Checker interface {
+	Check(ctx context.Context, rawURL string) error
+}
+
+// Chain проверяет адрес всеми стадиями по порядку до первого отказа
+type Chain []Checker
+
+func (chain Chain) Check(ctx context.Context, rawURL string) error {
+	for _, checker := range chain {
+		if err := checker.Check(ctx, rawURL); err != nil {
+			return err
+		}
+	}
+	return nil
+}
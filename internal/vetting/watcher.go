@@ -0,0 +1,101 @@
+package vetting
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// Watcher периодически перечитывает изменившиеся списки блокировок
+// и сообщает о выданных ссылках, адреса которых попали под новые списки.
+// Ссылки не удаляются: переход по ним блокируется при раскрытии, а ошибочный список достаточно исправить.
+type Watcher struct {
+	list     *Blocklist
+	store    storage.Storage
+	sugar    *zap.SugaredLogger
+	interval time.Duration
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+func NewWatcher(list *Blocklist, store storage.Storage, interval time.Duration, sugar *zap.SugaredLogger) *Watcher {
+	w := &Watcher{
+		list:     list,
+		store:    store,
+		sugar:    sugar,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Close останавливает слежение за списками
+func (w *Watcher) Close() {
+	w.once.Do(func() {
+		close(w.stop)
+		<-w.done
+	})
+}
+
+func (w *Watcher) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *Watcher) reload() {
+	changed, err := w.list.Reload()
+	if err != nil {
+		w.sugar.Error("Ошибка загрузки списков блокировки, действуют прежние:", err)
+		return
+	}
+	if !changed {
+		return
+	}
+	w.sugar.Info("Списки блокировки обновлены, перепроверяем ссылки")
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.interval)
+	defer cancel()
+	blocked, err := Recheck(ctx, w.store, w.list)
+	if err != nil {
+		w.sugar.Error("Ошибка перепроверки ссылок:", err)
+		return
+	}
+	for userID, shorts := range blocked {
+		w.sugar.Warnf("Заблокированы ссылки пользователя %d: %v", userID, shorts)
+	}
+}
+
+// Recheck проверяет действующие ссылки хранилища и возвращает заблокированные, сгруппированные по владельцу
+func Recheck(ctx context.Context, store storage.Storage, checker Checker) (map[int][]string, error) {
+	blocked := map[int][]string{}
+	err := store.ForEachLink(ctx, func(link storage.LinkInfo) error {
+		if link.Deleted {
+			return nil
+		}
+		// Адрес, который не удалось разобрать, не мешает проверить остальные
+		if err := checker.Check(ctx, link.OriginalURL); errors.Is(err, ErrBlocked) {
+			blocked[link.UserID] = append(blocked[link.UserID], link.ShortURL)
+		}
+		return nil
+	})
+	return blocked, err
+}
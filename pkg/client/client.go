@@ -0,0 +1,430 @@
+// Package client — типизированный клиент HTTP API сервиса сокращения ссылок.
+// Клиент хранит JWT-куку между запросами, сжимает тела запросов gzip,
+// повторяет запросы при сетевых ошибках и ответах 502/503/504.
+package client
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultRetries = 3
+	defaultBackoff = 100 * time.Millisecond
+	tokenCookie    = "jwt"
+)
+
+// Client — клиент сервиса. Один Client соответствует одному пользователю сервиса.
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	retries int
+	backoff time.Duration
+	gzip    bool
+	admin   string
+}
+
+type Option func(*Client)
+
+// WithHTTPClient задаёт HTTP-клиент. Если у него нет CookieJar, будет создан новый.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		copied := *httpClient
+		c.http = &copied
+	}
+}
+
+// WithRetries задаёт число повторов и начальную задержку, которая удваивается с каждой попыткой
+func WithRetries(retries int, backoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.backoff = backoff
+	}
+}
+
+// WithGzip включает или выключает сжатие тел запросов
+func WithGzip(enabled bool) Option {
+	return func(c *Client) {
+		c.gzip = enabled
+	}
+}
+
+// WithAdminToken передаёт административный токен в заголовке X-Admin-Token
+func WithAdminToken(token string) Option {
+	return func(c *Client) {
+		c.admin = token
+	}
+}
+
+func New(baseURL string, opts ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/") + "/")
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %w", err)
+	}
+
+	c := &Client{
+		baseURL: parsed,
+		http:    &http.Client{Timeout: 10 * time.Second},
+		retries: defaultRetries,
+		backoff: defaultBackoff,
+		gzip:    true,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if c.http.Jar == nil {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		c.http.Jar = jar
+	}
+	// Редиректы сервиса — это ответ на Resolve, следовать им не нужно
+	c.http.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return c, nil
+}
+
+// Token возвращает JWT текущего пользователя, если сервер его уже выдал
+func (c *Client) Token() string {
+	for _, cookie := range c.http.Jar.Cookies(c.baseURL) {
+		if cookie.Name == tokenCookie {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+// SetToken подставляет JWT существующего пользователя
+func (c *Client) SetToken(token string) {
+	c.http.Jar.SetCookies(c.baseURL, []*http.Cookie{{Name: tokenCookie, Value: token, Path: "/"}})
+}
+
+// Shorten сокращает адрес через POST /api/shorten.
+// Если адрес уже сокращён, возвращается *ConflictError с существующей ссылкой.
+func (c *Client) Shorten(ctx context.Context, original string, opts *ShortenOptions) (string, error) {
+	request := shortenRequest{URL: original}
+	if opts != nil {
+		request.ExpiresAt = opts.ExpiresAt
+		request.TTLSeconds = opts.TTLSeconds
+		request.Alias = opts.Alias
+		request.Password = opts.Password
+	}
+
+	var response shortenResponse
+	resp, body, err := c.doJSON(ctx, http.MethodPost, "api/shorten", request, http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return "", err
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return "", fmt.Errorf("decode response: %w", err)
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return response.Result, conflictFromBody(response.Result, body)
+	}
+	return response.Result, nil
+}
+
+// ShortenText сокращает адрес через POST / с телом text/plain
+func (c *Client) ShortenText(ctx context.Context, original string) (string, error) {
+	resp, body, err := c.do(ctx, http.MethodPost, "", "text/plain", []byte(original), http.StatusCreated, http.StatusConflict)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode == http.StatusConflict {
+		return string(body), &ConflictError{ShortURL: string(body)}
+	}
+	return string(body), nil
+}
+
+// ShortenBatch сокращает несколько адресов одним запросом POST /api/shorten/batch.
+// Исход каждой ссылки — в BatchResult.Status; ошибка возвращается, только если пакет не обработан.
+func (c *Client) ShortenBatch(ctx context.Context, items []BatchItem) ([]BatchResult, error) {
+	_, body, err := c.doJSON(ctx, http.MethodPost, "api/shorten/batch", items,
+		http.StatusCreated, http.StatusMultiStatus, http.StatusConflict)
+	if err != nil {
+		return nil, err
+	}
+	var results []BatchResult
+	if err := json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return results, nil
+}
+
+// Resolve возвращает адрес назначения короткой ссылки, не переходя по нему.
+// key — короткий код или полная короткая ссылка.
+func (c *Client) Resolve(ctx context.Context, key string) (string, error) {
+	resp, _, err := c.do(ctx, http.MethodGet, url.PathEscape(c.key(key)), "", nil, http.StatusTemporaryRedirect)
+	if err != nil {
+		return "", err
+	}
+	return resp.Header.Get("Location"), nil
+}
+
+// ExpandBatch раскрывает несколько коротких кодов или полных коротких ссылок одним запросом.
+// Результаты идут в порядке keys.
+func (c *Client) ExpandBatch(ctx context.Context, keys []string) ([]Expanded, error) {
+	_, body, err := c.doJSON(ctx, http.MethodPost, "api/expand/batch", keys, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var expanded []Expanded
+	if err := json.Unmarshal(body, &expanded); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return expanded, nil
+}
+
+// Lookup находит действующие короткие ссылки на адрес.
+// Без административного токена ищутся только ссылки текущего пользователя.
+func (c *Client) Lookup(ctx context.Context, original string) ([]LookupResult, error) {
+	_, body, err := c.do(ctx, http.MethodGet, "api/lookup?url="+url.QueryEscape(original), "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var links []LookupResult
+	if err := json.Unmarshal(body, &links); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return links, nil
+}
+
+// UserURLs возвращает ссылки текущего пользователя
+func (c *Client) UserURLs(ctx context.Context) ([]UserURL, error) {
+	resp, body, err := c.do(ctx, http.MethodGet, "api/user/urls", "", nil, http.StatusOK, http.StatusNoContent)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNoContent {
+		return []UserURL{}, nil
+	}
+	var urls []UserURL
+	if err := json.Unmarshal(body, &urls); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return urls, nil
+}
+
+// DeleteUserURLs ставит ссылки пользователя в очередь на удаление
+func (c *Client) DeleteUserURLs(ctx context.Context, keys []string) error {
+	codes := make([]string, 0, len(keys))
+	for _, key := range keys {
+		codes = append(codes, c.key(key))
+	}
+	_, _, err := c.doJSON(ctx, http.MethodDelete, "api/user/urls", codes, http.StatusAccepted)
+	return err
+}
+
+// UpdateURL меняет адрес назначения, заголовок или срок действия ссылки
+func (c *Client) UpdateURL(ctx context.Context, key string, update Update) (*Link, error) {
+	_, body, err := c.doJSON(ctx, http.MethodPatch, "api/user/urls/"+url.PathEscape(c.key(key)), update, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return decode[Link](body)
+}
+
+// Stats возвращает статистику переходов по ссылке
+func (c *Client) Stats(ctx context.Context, key string) (*Stats, error) {
+	_, body, err := c.do(ctx, http.MethodGet, "api/user/urls/"+url.PathEscape(c.key(key))+"/stats", "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return decode[Stats](body)
+}
+
+// History возвращает историю смены адреса назначения ссылки
+func (c *Client) History(ctx context.Context, key string) ([]HistoryEntry, error) {
+	_, body, err := c.do(ctx, http.MethodGet, "api/user/urls/"+url.PathEscape(c.key(key))+"/history", "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	var history []HistoryEntry
+	if err := json.Unmarshal(body, &history); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return history, nil
+}
+
+// Rollback отменяет изменение version и все последующие
+func (c *Client) Rollback(ctx context.Context, key string, version int) (*Link, error) {
+	path := "api/user/urls/" + url.PathEscape(c.key(key)) + "/rollback?version=" + strconv.Itoa(version)
+	_, body, err := c.do(ctx, http.MethodPost, path, "", nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return decode[Link](body)
+}
+
+// Ping проверяет доступность хранилища сервиса
+func (c *Client) Ping(ctx context.Context) error {
+	_, _, err := c.do(ctx, http.MethodGet, "ping", "", nil, http.StatusOK)
+	return err
+}
+
+// key оставляет от полной короткой ссылки только код
+func (c *Client) key(key string) string {
+	if parsed, err := url.Parse(key); err == nil && parsed.Scheme != "" {
+		return strings.TrimPrefix(parsed.Path, "/")
+	}
+	return key
+}
+
+func (c *Client) doJSON(ctx context.Context, method, path string, payload interface{}, expected ...int) (*http.Response, []byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode request: %w", err)
+	}
+	return c.do(ctx, method, path, "application/json", body, expected...)
+}
+
+// do выполняет запрос с повторами и возвращает прочитанное тело ответа.
+// Статус, которого нет в expected, превращается в ошибку.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte, expected ...int) (*http.Response, []byte, error) {
+	target, err := c.baseURL.Parse(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, encoding, err := c.encode(body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	backoff := c.backoff
+	for attempt := 0; ; attempt++ {
+		resp, respBody, err := c.send(ctx, method, target.String(), contentType, encoding, payload)
+		if err == nil && !retryable(resp.StatusCode) || attempt >= c.retries {
+			if err != nil {
+				return nil, nil, err
+			}
+			for _, status := range expected {
+				if resp.StatusCode == status {
+					return resp, respBody, nil
+				}
+			}
+			return resp, respBody, newError(resp.StatusCode, respBody)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, method, target, contentType, encoding string, payload []byte) (*http.Response, []byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if c.admin != "" {
+		req.Header.Set("X-Admin-Token", c.admin)
+	}
+	req.Header.Set("Accept-Encoding", "gzip")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	var bodyReader io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return nil, nil, fmt.Errorf("decode gzip response: %w", err)
+		}
+		defer gz.Close()
+		bodyReader = gz
+	}
+	respBody, err := io.ReadAll(bodyReader)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, respBody, nil
+}
+
+func (c *Client) encode(body []byte) ([]byte, string, error) {
+	if body == nil || !c.gzip {
+		return body, "", nil
+	}
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(body); err != nil {
+		return nil, "", err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, "", err
+	}
+	return buf.Bytes(), "gzip", nil
+}
+
+func retryable(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+func decode[T any](body []byte) (*T, error) {
+	var value T
+	if err := json.Unmarshal(body, &value); err != nil {
+		return nil, fmt.Errorf("decode response: %w", err)
+	}
+	return &value, nil
+}
+
+func conflictFromBody(shortURL string, body []byte) error {
+	var apiErr struct {
+		Error string `json:"error"`
+		Alias string `json:"alias"`
+	}
+	_ = json.Unmarshal(body, &apiErr)
+	return &ConflictError{ShortURL: shortURL, Code: apiErr.Error, Alias: apiErr.Alias}
+}
+
+func newError(status int, body []byte) error {
+	if status == http.StatusConflict {
+		return conflictFromBody("", body)
+	}
+	return &APIError{StatusCode: status, Body: strings.TrimSpace(string(body))}
+}
+
+// IsNotFound сообщает, что ссылки нет
+func IsNotFound(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// IsGone сообщает, что ссылка удалена или истекла
+func IsGone(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusGone
+}
@@ -0,0 +1,231 @@
+package client_test
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/config"
+	"github.com/skakunma/go-musthave-shortener-tpl/internal/handlers"
+	"github.com/skakunma/go-musthave-shortener-tpl/pkg/client"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testServer *httptest.Server
+
+func TestMain(m *testing.M) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg, err := config.LoadConfig(ctx)
+	if err != nil {
+		log.Fatalf("Failed to load config: %v", err)
+	}
+	router := gin.New()
+	handlers.SetupRoutes(router, cfg)
+	testServer = httptest.NewServer(router)
+	cfg.FlagBaseURL = testServer.URL + "/"
+
+	code := m.Run()
+	testServer.Close()
+	os.Exit(code)
+}
+
+func newClient(t *testing.T) *client.Client {
+	c, err := client.New(testServer.URL)
+	require.NoError(t, err)
+	return c
+}
+
+func TestShortenAndResolve(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t)
+
+	short, err := c.Shorten(ctx, "https://client.example.com/json", nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, c.Token(), "JWT cookie should be stored")
+
+	original, err := c.Resolve(ctx, short)
+	require.NoError(t, err)
+	assert.Equal(t, "https://client.example.com/json", original)
+
+	textShort, err := c.ShortenText(ctx, "https://client.example.com/text")
+	require.NoError(t, err)
+	original, err = c.Resolve(ctx, textShort)
+	require.NoError(t, err)
+	assert.Equal(t, "https://client.example.com/text", original)
+
+	_, err = c.Resolve(ctx, "doesnotexist")
+	assert.True(t, client.IsNotFound(err))
+
+	require.NoError(t, c.Ping(ctx))
+}
+
+func TestExpandBatch(t *testing.T) {
+	ctx := context.Background()
+	owner := newClient(t)
+
+	short, err := owner.Shorten(ctx, "https://client.example.com/expand", &client.ShortenOptions{TTLSeconds: 3600})
+	require.NoError(t, err)
+
+	expanded, err := owner.ExpandBatch(ctx, []string{short, "doesnotexist"})
+	require.NoError(t, err)
+	require.Len(t, expanded, 2)
+	assert.Equal(t, "active", expanded[0].Status)
+	assert.Equal(t, "https://client.example.com/expand", expanded[0].OriginalURL)
+	assert.True(t, expanded[0].Owner)
+	assert.NotNil(t, expanded[0].ExpiresAt)
+	assert.Equal(t, "not_found", expanded[1].Status)
+
+	expanded, err = newClient(t).ExpandBatch(ctx, []string{short})
+	require.NoError(t, err)
+	assert.False(t, expanded[0].Owner)
+	assert.Nil(t, expanded[0].ExpiresAt)
+}
+
+func TestLookup(t *testing.T) {
+	ctx := context.Background()
+	owner := newClient(t)
+
+	short, err := owner.Shorten(ctx, "https://client.example.com/lookup", &client.ShortenOptions{Alias: "client-lookup"})
+	require.NoError(t, err)
+
+	links, err := owner.Lookup(ctx, "https://client.example.com/lookup")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	assert.Equal(t, short, links[0].ShortURL)
+	assert.Zero(t, links[0].UserID)
+
+	_, err = newClient(t).Lookup(ctx, "https://client.example.com/lookup")
+	assert.True(t, client.IsNotFound(err))
+}
+
+func TestAliasConflict(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t)
+
+	alias := "client-" + time.Now().Format("150405.000000")[7:]
+	_, err := c.Shorten(ctx, "https://client.example.com/alias-1", &client.ShortenOptions{Alias: alias})
+	require.NoError(t, err)
+
+	_, err = c.Shorten(ctx, "https://client.example.com/alias-2", &client.ShortenOptions{Alias: alias})
+	var conflict *client.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, "alias_taken", conflict.Code)
+	assert.Equal(t, alias, conflict.Alias)
+}
+
+func TestURLConflict(t *testing.T) {
+	// Хранилище в памяти не ищет ссылки по исходному адресу, поэтому 409 отдаёт заглушка
+	const existing = "http://localhost:8080/existing"
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "gzip", r.Header.Get("Content-Encoding"))
+		if r.URL.Path == "/api/shorten" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(`{"result":"` + existing + `"}`))
+			return
+		}
+		w.WriteHeader(http.StatusConflict)
+		_, _ = w.Write([]byte(existing))
+	}))
+	defer stub.Close()
+
+	c, err := client.New(stub.URL)
+	require.NoError(t, err)
+
+	short, err := c.Shorten(context.Background(), "https://client.example.com/dup", nil)
+	var conflict *client.ConflictError
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, existing, conflict.ShortURL)
+	assert.Equal(t, existing, short)
+
+	short, err = c.ShortenText(context.Background(), "https://client.example.com/dup")
+	require.ErrorAs(t, err, &conflict)
+	assert.Equal(t, existing, conflict.ShortURL)
+	assert.Equal(t, existing, short)
+}
+
+func TestUserURLs(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t)
+
+	urls, err := c.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+
+	results, err := c.ShortenBatch(ctx, []client.BatchItem{
+		{CorrelationID: "1", OriginalURL: "https://client.example.com/batch/1"},
+		{CorrelationID: "2", OriginalURL: "https://client.example.com/batch/2"},
+	})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+
+	urls, err = c.UserURLs(ctx)
+	require.NoError(t, err)
+	assert.Len(t, urls, 2)
+
+	newURL := "https://client.example.com/batch/updated"
+	link, err := c.UpdateURL(ctx, results[0].ShortURL, client.Update{URL: &newURL})
+	require.NoError(t, err)
+	assert.Equal(t, newURL, link.OriginalURL)
+
+	history, err := c.History(ctx, results[0].ShortURL)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+
+	link, err = c.Rollback(ctx, results[0].ShortURL, history[0].Version)
+	require.NoError(t, err)
+	assert.Equal(t, "https://client.example.com/batch/1", link.OriginalURL)
+
+	_, err = c.Resolve(ctx, results[1].ShortURL)
+	require.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		stats, err := c.Stats(ctx, results[1].ShortURL)
+		return err == nil && stats.TotalClicks == 1
+	}, 3*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, c.DeleteUserURLs(ctx, []string{results[1].ShortURL}))
+	assert.Eventually(t, func() bool {
+		_, err := c.Resolve(ctx, results[1].ShortURL)
+		return client.IsGone(err)
+	}, 3*time.Second, 50*time.Millisecond)
+
+	other := newClient(t)
+	_, err = other.Stats(ctx, results[0].ShortURL)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	assert.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+}
+
+func TestRetries(t *testing.T) {
+	var calls atomic.Int32
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer flaky.Close()
+
+	c, err := client.New(flaky.URL, client.WithRetries(3, time.Millisecond))
+	require.NoError(t, err)
+	require.NoError(t, c.Ping(context.Background()))
+	assert.Equal(t, int32(3), calls.Load())
+
+	calls.Store(-10)
+	c, err = client.New(flaky.URL, client.WithRetries(1, time.Millisecond))
+	require.NoError(t, err)
+	var apiErr *client.APIError
+	require.ErrorAs(t, c.Ping(context.Background()), &apiErr)
+	assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+}
@@ -0,0 +1,130 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// ShortenOptions — необязательные параметры сокращения
+type ShortenOptions struct {
+	ExpiresAt  *time.Time
+	TTLSeconds int
+	Alias      string
+	// Password защищает ссылку паролем, который спросят при переходе
+	Password string
+}
+
+type shortenRequest struct {
+	URL        string     `json:"url"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int        `json:"ttl_seconds,omitempty"`
+	Alias      string     `json:"alias,omitempty"`
+	Password   string     `json:"password,omitempty"`
+}
+
+type shortenResponse struct {
+	Result string `json:"result"`
+}
+
+type BatchItem struct {
+	CorrelationID string     `json:"correlation_id"`
+	OriginalURL   string     `json:"original_url"`
+	ExpiresAt     *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds    int        `json:"ttl_seconds,omitempty"`
+	Alias         string     `json:"alias,omitempty"`
+}
+
+// Expanded — сведения о короткой ссылке из ExpandBatch.
+// Status равен active, blocked, deleted, expired, not_found или invalid.
+// Title, ExpiresAt и адрес неактивной ссылки заполняются только для ссылок текущего пользователя.
+type Expanded struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url,omitempty"`
+	Status      string     `json:"status"`
+	Owner       bool       `json:"owner"`
+	Title       string     `json:"title,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+// LookupResult — короткая ссылка из Lookup. UserID заполняется только для администратора.
+type LookupResult struct {
+	ShortURL  string     `json:"short_url"`
+	Title     string     `json:"title,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	UserID    int        `json:"user_id,omitempty"`
+}
+
+// BatchResult — исход одной ссылки пакета: Status равен created, exists, invalid, blocked или error
+type BatchResult struct {
+	CorrelationID string `json:"correlation_id"`
+	ShortURL      string `json:"short_url,omitempty"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+}
+
+type UserURL struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+}
+
+// Update — изменения ссылки, nil-поля не меняются
+type Update struct {
+	URL        *string    `json:"url,omitempty"`
+	Title      *string    `json:"title,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	TTLSeconds int        `json:"ttl_seconds,omitempty"`
+}
+
+type Link struct {
+	ShortURL    string     `json:"short_url"`
+	OriginalURL string     `json:"original_url"`
+	Title       string     `json:"title,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+}
+
+type DailyClicks struct {
+	Date   string `json:"date"`
+	Clicks int    `json:"clicks"`
+}
+
+type Stats struct {
+	TotalClicks    int           `json:"total_clicks"`
+	UniqueVisitors int           `json:"unique_visitors"`
+	Daily          []DailyClicks `json:"daily"`
+}
+
+type HistoryEntry struct {
+	Version   int       `json:"version"`
+	OldURL    string    `json:"old_url"`
+	NewURL    string    `json:"new_url"`
+	UserID    int       `json:"user_id"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// ConflictError — ответ 409. Если адрес уже был сокращён, ShortURL содержит существующую ссылку;
+// если занят алиас, Code равен "alias_taken".
+type ConflictError struct {
+	ShortURL string
+	Code     string
+	Alias    string
+}
+
+func (e *ConflictError) Error() string {
+	if e.ShortURL != "" {
+		return "URL already shortened: " + e.ShortURL
+	}
+	if e.Alias != "" {
+		return fmt.Sprintf("conflict: %s (%s)", e.Code, e.Alias)
+	}
+	return "conflict: " + e.Code
+}
+
+// APIError — неожиданный статус ответа сервиса
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.StatusCode, e.Body)
+}